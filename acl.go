@@ -0,0 +1,235 @@
+package netboxdns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const (
+	aclAllow  string = "allow"
+	aclDeny   string = "deny"
+	aclRefuse string = "refuse"
+)
+
+// aclRule applies action to requests from clients within any of prefixes
+type aclRule struct {
+	action   string
+	prefixes []netip.Prefix
+}
+
+func (rule aclRule) matches(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range rule.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclConfig restricts the clients that may send requests for names within
+// zones, independently of views
+type aclConfig struct {
+	// zones maps zone names to the rules configured for them
+	zones map[string][]aclRule
+	// tags maps tag slugs to the rules of the Netbox zones carrying them
+	tags map[string][]aclRule
+	// tagOrder holds the tag slugs in the order they were configured
+	tagOrder []string
+	// field is the custom field of Netbox zones holding their rules
+	field string
+}
+
+func newACLConfig() *aclConfig {
+	return &aclConfig{
+		zones: make(map[string][]aclRule),
+		tags:  make(map[string][]aclRule),
+	}
+}
+
+// parseACLRule parses an action followed by prefixes or addresses
+func parseACLRule(args []string) (aclRule, error) {
+	if len(args) < 2 {
+		return aclRule{}, fmt.Errorf(
+			"rule %q requires an action and a network",
+			strings.Join(args, " "),
+		)
+	}
+	rule := aclRule{action: args[0]}
+	switch rule.action {
+	case aclAllow, aclDeny, aclRefuse:
+	default:
+		return aclRule{}, fmt.Errorf("invalid action %q", rule.action)
+	}
+	for _, arg := range args[1:] {
+		prefix, err := netip.ParsePrefix(arg)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(arg)
+			if addrErr != nil {
+				return aclRule{}, fmt.Errorf("invalid network %q", arg)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		rule.prefixes = append(rule.prefixes, prefix.Masked())
+	}
+	return rule, nil
+}
+
+// fieldRules parses the rules in the custom field value of a zone. A text
+// field holds one rule per line or separated by semicolons, a JSON field a
+// list of rules.
+func fieldRules(value any) ([]aclRule, error) {
+	var lines []string
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		lines = strings.FieldsFunc(value, func(r rune) bool {
+			return r == '\n' || r == ';'
+		})
+	case []any:
+		for _, line := range value {
+			text, ok := line.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid rule %v", line)
+			}
+			lines = append(lines, text)
+		}
+	default:
+		return nil, fmt.Errorf("invalid rules %v", value)
+	}
+	var rules []aclRule
+	for _, line := range lines {
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		rule, err := parseACLRule(args)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// netboxRules returns the rules of a Netbox zone from its tags and custom
+// field
+func (config *aclConfig) netboxRules(zone netbox.Zone) []aclRule {
+	var rules []aclRule
+	for _, slug := range config.tagOrder {
+		for _, tag := range zone.Tags {
+			if tag.Slug == slug {
+				rules = append(rules, config.tags[slug]...)
+				break
+			}
+		}
+	}
+	if config.field != "" {
+		fieldValue, err := fieldRules(zone.CustomFields[config.field])
+		if err != nil {
+			// a broken rule must not open the zone to every client
+			logger.Warningf(
+				"refusing requests for zone %q: custom field %q: %v",
+				zone.Name,
+				config.field,
+				err,
+			)
+			fieldValue = []aclRule{{
+				action: aclRefuse,
+				prefixes: []netip.Prefix{
+					netip.MustParsePrefix("0.0.0.0/0"),
+					netip.MustParsePrefix("::/0"),
+				},
+			}}
+		}
+		rules = append(rules, fieldValue...)
+	}
+	return rules
+}
+
+// aclAction returns the action for a request for qname from addr. The rules
+// of the most specific zone containing qname apply, those configured in the
+// Corefile before those loaded from Netbox zones of that name in any view.
+// The first rule matching addr decides; requests matching none are allowed.
+func (netboxdns *NetboxDNS) aclAction(
+	ctx context.Context,
+	qname string,
+	addr netip.Addr,
+) (string, error) {
+	span, ctx := netbox.StartSpan(ctx, "aclAction")
+	defer span.Finish()
+	config := netboxdns.acl
+	if config == nil {
+		return aclAllow, nil
+	}
+	zoneName := ""
+	for zone := range config.zones {
+		if dns.IsSubDomain(zone, qname) && len(zone) > len(zoneName) {
+			zoneName = zone
+		}
+	}
+	netboxRules := make(map[string][]aclRule)
+	if len(config.tags) > 0 || config.field != "" {
+		zones, err := netboxdns.getZones(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, zone := range zones {
+			name := fqdnKey(zone.Name)
+			if !dns.IsSubDomain(name, qname) {
+				continue
+			}
+			zoneRules := config.netboxRules(zone)
+			if len(zoneRules) == 0 {
+				continue
+			}
+			netboxRules[name] = append(netboxRules[name], zoneRules...)
+			if len(name) > len(zoneName) {
+				zoneName = name
+			}
+		}
+	}
+	var rules []aclRule
+	rules = append(rules, config.zones[zoneName]...)
+	rules = append(rules, netboxRules[zoneName]...)
+	for _, rule := range rules {
+		if rule.matches(addr) {
+			return rule.action, nil
+		}
+	}
+	return aclAllow, nil
+}
+
+// checkACL answers a request denied by the ACL of its zone. A refused
+// request is answered with REFUSED, a denied one is dropped without an
+// answer. It returns whether the request was handled.
+func (netboxdns *NetboxDNS) checkACL(
+	ctx context.Context,
+	writer dns.ResponseWriter,
+	reqMsg *dns.Msg,
+	qname string,
+	reqIP netip.Addr,
+) (bool, error) {
+	action, err := netboxdns.aclAction(ctx, qname, reqIP)
+	if err != nil {
+		return false, err
+	}
+	switch action {
+	case aclDeny:
+		logger.Debugf("dropping request for %q from %v", qname, reqIP)
+		return true, nil
+	case aclRefuse:
+		logger.Debugf("refusing request for %q from %v", qname, reqIP)
+		respMsg := new(dns.Msg)
+		respMsg.SetRcode(reqMsg, dns.RcodeRefused)
+		writer.WriteMsg(respMsg)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,144 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func testACLRule(t *testing.T, args ...string) aclRule {
+	t.Helper()
+	rule, err := parseACLRule(args)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return rule
+}
+
+func TestACL(t *testing.T) {
+	tests := []struct {
+		name     string
+		qname    string
+		remoteIP string
+		tag      bool
+		field    any
+		rcode    int
+		dropped  bool
+	}{
+		{
+			name:     "allowed network",
+			qname:    "web.example.com.",
+			remoteIP: "10.240.0.1",
+			rcode:    dns.RcodeSuccess,
+		},
+		{
+			name:     "refused network",
+			qname:    "web.example.com.",
+			remoteIP: "192.0.2.1",
+			rcode:    dns.RcodeRefused,
+		},
+		{
+			name:     "denied network",
+			qname:    "web.example.com.",
+			remoteIP: "198.51.100.1",
+			dropped:  true,
+		},
+		{
+			name:     "zone without rules",
+			qname:    "web.example.org.",
+			remoteIP: "192.0.2.1",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "rules of tagged zone",
+			qname:    "host.sub.example.com.",
+			remoteIP: "10.240.0.1",
+			tag:      true,
+			rcode:    dns.RcodeRefused,
+		},
+		{
+			name:     "rules of custom field",
+			qname:    "host.sub.example.com.",
+			remoteIP: "10.0.1.1",
+			field:    "allow 10.0.1.0/24; refuse 0.0.0.0/0 ::/0",
+			rcode:    dns.RcodeSuccess,
+		},
+		{
+			name:     "rules of custom field refuse",
+			qname:    "host.sub.example.com.",
+			remoteIP: "10.240.0.1",
+			field:    []any{"allow 10.0.1.0/24", "refuse 0.0.0.0/0"},
+			rcode:    dns.RcodeRefused,
+		},
+		{
+			name:     "invalid custom field",
+			qname:    "host.sub.example.com.",
+			remoteIP: "10.0.1.1",
+			field:    "permit 10.0.1.0/24",
+			rcode:    dns.RcodeRefused,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t)
+			netboxdns.acl = newACLConfig()
+			netboxdns.acl.zones["example.com."] = []aclRule{
+				testACLRule(t, aclAllow, "10.0.0.0/8"),
+				testACLRule(t, aclDeny, "198.51.100.0/24"),
+				testACLRule(t, aclRefuse, "0.0.0.0/0"),
+			}
+			netboxdns.acl.tags["internal"] = []aclRule{testACLRule(t, aclRefuse, "10.240.0.0/16")}
+			netboxdns.acl.tagOrder = []string{"internal"}
+			netboxdns.acl.field = "dns_acl"
+			zone, _ := netboxdns.snapshot.getZone(2)
+			if tt.tag {
+				zone.Tags = []netbox.NestedObject{{ID: 1, Name: "Internal", Slug: "internal"}}
+			}
+			zone.CustomFields = map[string]any{"dns_acl": tt.field}
+			netboxdns.snapshot.putZone(zone)
+
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tt.remoteIP})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.dropped {
+				if rec.Msg != nil {
+					t.Errorf("expected no response, got %v", rec.Msg)
+				}
+				return
+			}
+			if rec.Msg == nil {
+				t.Fatal("expected a response, got none")
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+		})
+	}
+}
+
+func TestACLRuleMatches(t *testing.T) {
+	rule := testACLRule(t, aclAllow, "10.0.0.0/8", "2001:db8::1")
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		if got := rule.matches(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("matches(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package netboxdns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+const defaultChangelogResync time.Duration = time.Hour * 24
+
+var changelogObjectTypes []string = []string{
+	netbox.ObjectTypeView,
+	netbox.ObjectTypeZone,
+	netbox.ObjectTypeRecord,
+}
+
+// changelogSync tracks the position of the plugin in the Netbox changelog
+type changelogSync struct {
+	// resync is the interval a full snapshot reload is forced at
+	resync time.Duration
+
+	lastChangeID int
+	lastFullSync time.Time
+}
+
+// syncSnapshot brings the snapshot up to date. Without changelog sync this is
+// a full reload. With changelog sync, a full reload only happens when no
+// snapshot is loaded, the resync interval has elapsed, or the changelog no
+// longer contains the last applied change.
+func (netboxdns *NetboxDNS) syncSnapshot(ctx context.Context) error {
+	sync := netboxdns.changelog
+	if sync == nil {
+		return netboxdns.loadSnapshot(ctx)
+	}
+	if !netboxdns.snapshot.ready() || time.Since(sync.lastFullSync) >= sync.resync {
+		return netboxdns.fullSync(ctx)
+	}
+	if sync.lastChangeID > 0 {
+		exists, err := netbox.ObjectChangeExists(
+			ctx,
+			netboxdns.requestClient,
+			sync.lastChangeID,
+		)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			logger.Warningf(
+				"changelog entry %d has been pruned; performing full resync",
+				sync.lastChangeID,
+			)
+			return netboxdns.fullSync(ctx)
+		}
+	}
+	changes, err := netbox.GetObjectChangesSince(
+		ctx,
+		netboxdns.requestClient,
+		changelogObjectTypes,
+		sync.lastChangeID,
+	)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := netboxdns.applyChange(ctx, change); err != nil {
+			return fmt.Errorf(
+				"could not apply changelog entry %d: %w",
+				change.ID,
+				err,
+			)
+		}
+		sync.lastChangeID = change.ID
+	}
+	if len(changes) > 0 {
+		logger.Debugf("applied %d changelog entries", len(changes))
+	}
+	return nil
+}
+
+// fullSync reloads the snapshot and moves the changelog position to the
+// newest entry. The position is read before loading so changes made during
+// the load are applied again on the next sync.
+func (netboxdns *NetboxDNS) fullSync(ctx context.Context) error {
+	latest, err := netbox.GetLatestObjectChangeID(ctx, netboxdns.requestClient)
+	if err != nil {
+		return err
+	}
+	if err := netboxdns.loadSnapshot(ctx); err != nil {
+		return err
+	}
+	netboxdns.changelog.lastChangeID = latest
+	netboxdns.changelog.lastFullSync = time.Now()
+	return nil
+}
+
+// applyChange applies a single changelog entry to the snapshot. Created and
+// updated objects are fetched from the API so the snapshot holds the same
+// representation as a full load.
+func (netboxdns *NetboxDNS) applyChange(ctx context.Context, change netbox.ObjectChange) error {
+	deleted := change.Action.Value == netbox.ChangeActionDelete
+	switch change.ChangedObjectType {
+	case netbox.ObjectTypeRecord:
+		if deleted {
+			netboxdns.snapshot.deleteRecord(change.ChangedObjectID)
+			return nil
+		}
+		record, err := netbox.GetRecord(
+			ctx,
+			netboxdns.requestClient,
+			change.ChangedObjectID,
+		)
+		if netbox.IsNotFound(err) {
+			netboxdns.snapshot.deleteRecord(change.ChangedObjectID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		netboxdns.snapshot.putRecord(record)
+	case netbox.ObjectTypeZone:
+		if deleted {
+			netboxdns.snapshot.deleteZone(change.ChangedObjectID)
+			return nil
+		}
+		zone, err := netbox.GetZone(
+			ctx,
+			netboxdns.requestClient,
+			change.ChangedObjectID,
+		)
+		if netbox.IsNotFound(err) {
+			netboxdns.snapshot.deleteZone(change.ChangedObjectID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return netboxdns.putZone(ctx, zone)
+	case netbox.ObjectTypeView:
+		if deleted {
+			netboxdns.snapshot.deleteView(change.ChangedObjectID)
+			return nil
+		}
+		view, err := netbox.GetView(
+			ctx,
+			netboxdns.requestClient,
+			change.ChangedObjectID,
+		)
+		if netbox.IsNotFound(err) {
+			netboxdns.snapshot.deleteView(change.ChangedObjectID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		netboxdns.snapshot.putView(view)
+	}
+	return nil
+}
+
+// putZone stores zone in the snapshot. When a zone is renamed, the FQDNs of
+// all of its records change, so they are fetched again.
+func (netboxdns *NetboxDNS) putZone(ctx context.Context, zone netbox.Zone) error {
+	served, err := netboxdns.zoneServed(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if !served {
+		netboxdns.snapshot.deleteZone(zone.ID)
+		return nil
+	}
+	previous, existed := netboxdns.snapshot.putZone(zone)
+	if existed && previous.Name == zone.Name {
+		return nil
+	}
+	records, err := netbox.GetRecordsUnresolved(
+		ctx,
+		netboxdns.requestClient,
+		netboxdns.servedQuery(&netbox.RecordQuery{Zone: &zone}),
+	)
+	if err != nil {
+		return err
+	}
+	netboxdns.snapshot.setZoneRecords(zone.ID, records)
+	return nil
+}
@@ -0,0 +1,538 @@
+package netboxdns
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const (
+	dnssecCacheSize     int           = 10000
+	dnssecInception     time.Duration = -time.Hour * 3
+	dnssecValidity      time.Duration = time.Hour * 24 * 8
+	dnssecRefreshBefore time.Duration = time.Hour * 24 * 2
+)
+
+// zoneKey is a DNSSEC key pair of a signed zone
+type zoneKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+	tag    uint16
+}
+
+// isKSK reports whether the key has the secure entry point flag set
+func (key *zoneKey) isKSK() bool {
+	return key.dnskey.Flags&dns.SEP != 0
+}
+
+// readZoneKey reads the key pair stored in base.key and base.private, as
+// written by dnssec-keygen
+func readZoneKey(base string) (*zoneKey, error) {
+	base = strings.TrimSuffix(strings.TrimSuffix(base, ".key"), ".private")
+	publicFile, err := os.Open(base + ".key")
+	if err != nil {
+		return nil, err
+	}
+	defer publicFile.Close()
+	rr, err := dns.ReadRR(publicFile, base+".key")
+	if err != nil {
+		return nil, err
+	}
+	dnskey, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, fmt.Errorf("%s.key does not contain a DNSKEY record", base)
+	}
+
+	privateFile, err := os.Open(base + ".private")
+	if err != nil {
+		return nil, err
+	}
+	defer privateFile.Close()
+	privateKey, err := dnskey.ReadPrivateKey(privateFile, base+".private")
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s.private does not contain a signing key", base)
+	}
+	return &zoneKey{dnskey: dnskey, signer: signer, tag: dnskey.KeyTag()}, nil
+}
+
+// dnssecSigner signs responses for zones with configured keys. Signatures
+// are cached per RRset and replaced before they expire.
+type dnssecSigner struct {
+	// keys maps zone names to their keys
+	keys  map[string][]*zoneKey
+	cache *cache.Cache
+}
+
+func newDNSSECSigner() *dnssecSigner {
+	return &dnssecSigner{
+		keys:  make(map[string][]*zoneKey),
+		cache: cache.New(dnssecCacheSize),
+	}
+}
+
+// addKey adds key to zone after checking that it belongs to it
+func (signer *dnssecSigner) addKey(zone string, key *zoneKey) error {
+	if fqdnKey(key.dnskey.Hdr.Name) != fqdnKey(zone) {
+		return fmt.Errorf(
+			"key %d is for zone %q, not %q",
+			key.tag,
+			key.dnskey.Hdr.Name,
+			zone,
+		)
+	}
+	signer.keys[fqdnKey(zone)] = append(signer.keys[fqdnKey(zone)], key)
+	return nil
+}
+
+// zoneKeys returns the keys of the zone named name
+func (signer *dnssecSigner) zoneKeys(name string) []*zoneKey {
+	if signer == nil {
+		return nil
+	}
+	return signer.keys[fqdnKey(name)]
+}
+
+// dnskeys returns the DNSKEY RRset of zone
+func (signer *dnssecSigner) dnskeys(zone string) []dns.RR {
+	keys := signer.zoneKeys(zone)
+	out := make([]dns.RR, 0, len(keys))
+	for _, key := range keys {
+		dnskey := dns.Copy(key.dnskey)
+		dnskey.Header().Name = dns.Fqdn(zone)
+		out = append(out, dnskey)
+	}
+	return out
+}
+
+// signingKeys returns the keys used to sign an RRset of rrtype. DNSKEY is
+// signed with the key signing keys and everything else with the zone signing
+// keys. A zone with only one kind of key uses it for both.
+func signingKeys(keys []*zoneKey, rrtype uint16) []*zoneKey {
+	var ksk, zsk []*zoneKey
+	for _, key := range keys {
+		if key.isKSK() {
+			ksk = append(ksk, key)
+		} else {
+			zsk = append(zsk, key)
+		}
+	}
+	if rrtype == dns.TypeDNSKEY && len(ksk) > 0 {
+		return ksk
+	}
+	if len(zsk) > 0 {
+		return zsk
+	}
+	return ksk
+}
+
+// signRRset returns the RRSIG records of rrset in zone, using the cached
+// signatures while they are valid for long enough
+func (signer *dnssecSigner) signRRset(zone string, rrset []dns.RR) ([]dns.RR, error) {
+	key := rrsetHash(zone, rrset)
+	now := time.Now().UTC()
+	if cached, ok := signer.cache.Get(key); ok {
+		sigs := cached.([]dns.RR)
+		if signaturesValid(sigs, now.Add(dnssecRefreshBefore)) {
+			return copyRRs(sigs), nil
+		}
+	}
+
+	keys := signingKeys(signer.zoneKeys(zone), rrset[0].Header().Rrtype)
+	sigs := make([]dns.RR, 0, len(keys))
+	for _, zoneKey := range keys {
+		sig := &dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Ttl: rrset[0].Header().Ttl,
+			},
+			KeyTag:     zoneKey.tag,
+			SignerName: dns.Fqdn(zone),
+			Algorithm:  zoneKey.dnskey.Algorithm,
+			Inception:  uint32(now.Add(dnssecInception).Unix()),
+			Expiration: uint32(now.Add(dnssecValidity).Unix()),
+		}
+		if err := sig.Sign(zoneKey.signer, rrset); err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	signer.cache.Add(key, sigs)
+	return copyRRs(sigs), nil
+}
+
+// signSection appends the signatures of every RRset in rrs that belongs to
+// zone. NS RRsets below the apex are delegations and stay unsigned, as do
+// records outside of zone such as glue. RRsets owned by qname that were
+// synthesized from wildcard are signed as the wildcard.
+func (signer *dnssecSigner) signSection(
+	zone string,
+	rrs []dns.RR,
+	qname string,
+	wildcard string,
+) ([]dns.RR, error) {
+	out := rrs
+	for _, rrset := range groupRRsets(rrs) {
+		header := rrset[0].Header()
+		if !dns.IsSubDomain(zone, header.Name) {
+			continue
+		}
+		if header.Rrtype == dns.TypeNS && fqdnKey(header.Name) != fqdnKey(zone) {
+			continue
+		}
+		expanded := wildcard != "" && fqdnKey(header.Name) == fqdnKey(qname)
+		if expanded {
+			rrset = copyRRs(rrset)
+			for _, rr := range rrset {
+				rr.Header().Name = wildcard
+			}
+		}
+		sigs, err := signer.signRRset(zone, rrset)
+		if err != nil {
+			return nil, err
+		}
+		if expanded {
+			for _, sig := range sigs {
+				sig.Header().Name = header.Name
+			}
+		}
+		out = append(out, sigs...)
+	}
+	return out, nil
+}
+
+// groupRRsets splits rrs into RRsets in order of first appearance, leaving
+// out existing signatures and OPT records
+func groupRRsets(rrs []dns.RR) [][]dns.RR {
+	index := make(map[string]int)
+	var out [][]dns.RR
+	for _, rr := range rrs {
+		header := rr.Header()
+		if header.Rrtype == dns.TypeRRSIG || header.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := fqdnKey(header.Name) + "/" + dns.TypeToString[header.Rrtype]
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, []dns.RR{rr})
+			continue
+		}
+		out[i] = append(out[i], rr)
+	}
+	return out
+}
+
+// rrsetHash returns the signature cache key of rrset in zone
+func rrsetHash(zone string, rrset []dns.RR) uint64 {
+	h := fnv.New64()
+	io.WriteString(h, fqdnKey(zone))
+	for _, rr := range rrset {
+		io.WriteString(h, rr.String())
+	}
+	return h.Sum64()
+}
+
+func signaturesValid(sigs []dns.RR, at time.Time) bool {
+	for _, sig := range sigs {
+		if !sig.(*dns.RRSIG).ValidityPeriod(at) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyRRs(rrs []dns.RR) []dns.RR {
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = dns.Copy(rr)
+	}
+	return out
+}
+
+// signResponse signs the answer and authority sections of msg for the zone
+// of response and adds NSEC records proving the denial of qname or qtype, or
+// that qname did not exist for a wildcard answer
+func (netboxdns *NetboxDNS) signResponse(
+	ctx context.Context,
+	msg *dns.Msg,
+	response *lookupResponse,
+	qname string,
+) error {
+	span, ctx := netbox.StartSpan(ctx, "signResponse")
+	defer span.Finish()
+	signer := netboxdns.dnssec
+	zoneName := dns.Fqdn(response.Zone.Name)
+	if len(signer.zoneKeys(zoneName)) == 0 {
+		return nil
+	}
+	nameError := msg.Rcode == dns.RcodeNameError
+	noData := msg.Rcode == dns.RcodeSuccess && msg.Authoritative && len(msg.Answer) == 0
+	if nameError || noData || response.Wildcard != "" {
+		nsec, err := netboxdns.denial(ctx, response.Zone, qname, response.Wildcard != "")
+		if err != nil {
+			return err
+		}
+		msg.Ns = append(msg.Ns, nsec...)
+	}
+	if response.LookupResult == lookupDelegation {
+		proof, err := netboxdns.delegationProof(ctx, response.Zone, msg.Ns)
+		if err != nil {
+			return err
+		}
+		msg.Ns = append(msg.Ns, proof...)
+	}
+
+	answer, err := signer.signSection(zoneName, msg.Answer, qname, response.Wildcard)
+	if err != nil {
+		return err
+	}
+	ns, err := signer.signSection(zoneName, msg.Ns, qname, response.Wildcard)
+	if err != nil {
+		return err
+	}
+	msg.Answer = answer
+	msg.Ns = ns
+	return nil
+}
+
+// nsecChain is the NSEC chain of a zone in canonical order
+type nsecChain []*dns.NSEC
+
+// zoneNSEC returns the NSEC chain of zone, which is cached in the snapshot
+// until the zone changes
+func (netboxdns *NetboxDNS) zoneNSEC(ctx context.Context, zone *netbox.Zone) (nsecChain, error) {
+	if !netboxdns.snapshot.ready() {
+		return netboxdns.buildZoneNSEC(ctx, zone)
+	}
+	return zoneCached(netboxdns, zone, "nsec", func() (nsecChain, error) {
+		return netboxdns.buildZoneNSEC(ctx, zone)
+	})
+}
+
+// buildZoneNSEC builds the NSEC chain of zone from the owner names of its
+// records. Names below a delegation are not authoritative and are left out.
+func (netboxdns *NetboxDNS) buildZoneNSEC(
+	ctx context.Context,
+	zone *netbox.Zone,
+) (nsecChain, error) {
+	soa, rrs, err := netboxdns.zoneRRs(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	apex := dns.Fqdn(zone.Name)
+	// the TTL of NSEC records is the negative caching TTL of the zone, the
+	// lower of the SOA TTL and minimum (RFC 9077 section 3.1); it is their
+	// own TTL and the original TTL of their signatures
+	ttl := min(soa.Hdr.Ttl, soa.Minttl)
+
+	types := map[string]map[uint16]bool{
+		fqdnKey(apex): {
+			dns.TypeSOA:    true,
+			dns.TypeDNSKEY: true,
+		},
+	}
+	var delegations []string
+	for _, rr := range rrs {
+		header := rr.Header()
+		name := fqdnKey(header.Name)
+		if header.Rrtype == dns.TypeNS && name != fqdnKey(apex) {
+			delegations = append(delegations, name)
+		}
+		if types[name] == nil {
+			types[name] = make(map[uint16]bool)
+		}
+		types[name][header.Rrtype] = true
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		if belowDelegation(name, delegations) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return canonicalLess(names[i], names[j])
+	})
+
+	chain := make(nsecChain, len(names))
+	for i, name := range names {
+		bitmap := []uint16{dns.TypeNSEC, dns.TypeRRSIG}
+		for rrtype := range types[name] {
+			bitmap = append(bitmap, rrtype)
+		}
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		chain[i] = &dns.NSEC{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeNSEC,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: bitmap,
+		}
+	}
+	return chain, nil
+}
+
+// match returns the NSEC record owned by name, or the one covering it
+func (chain nsecChain) match(name string) *dns.NSEC {
+	name = fqdnKey(name)
+	i := sort.Search(len(chain), func(i int) bool {
+		return !canonicalLess(chain[i].Hdr.Name, name)
+	})
+	if i < len(chain) && chain[i].Hdr.Name == name {
+		return chain[i]
+	}
+	if i == 0 {
+		return chain[len(chain)-1]
+	}
+	return chain[i-1]
+}
+
+// exists reports whether name owns records or is an empty non-terminal
+func (chain nsecChain) exists(name string) bool {
+	name = fqdnKey(name)
+	for _, nsec := range chain {
+		if dns.IsSubDomain(name, nsec.Hdr.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// denial returns the NSEC records proving that qname does not exist, or that
+// it has no records of the queried type. For an answer synthesized from a
+// wildcard only the nonexistence of qname is proven.
+func (netboxdns *NetboxDNS) denial(
+	ctx context.Context,
+	zone *netbox.Zone,
+	qname string,
+	synthesized bool,
+) ([]dns.RR, error) {
+	chain, err := netboxdns.zoneNSEC(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	// the chain is cached, so the response holds copies of its records
+	proof := chain.match(qname)
+	out := []dns.RR{dns.Copy(proof)}
+	if synthesized || chain.exists(qname) {
+		return out, nil
+	}
+	// prove which wildcard at the closest encloser did or could have matched
+	encloser := fqdnKey(qname)
+	for encloser != fqdnKey(zone.Name) && !chain.exists(encloser) {
+		encloser = parentName(encloser)
+	}
+	wildcard := chain.match("*." + encloser)
+	if wildcard != proof {
+		out = append(out, dns.Copy(wildcard))
+	}
+	return out, nil
+}
+
+// delegationProof returns the DS RRset of the delegation in ns, or the NSEC
+// record of the delegation point proving that it has none, so that validators
+// treat the child zone as secure or insecure rather than bogus (RFC 4035
+// section 3.1.4)
+func (netboxdns *NetboxDNS) delegationProof(
+	ctx context.Context,
+	zone *netbox.Zone,
+	ns []dns.RR,
+) ([]dns.RR, error) {
+	if len(ns) == 0 {
+		return nil, nil
+	}
+	name := dns.Fqdn(ns[0].Header().Name)
+	records, err := netboxdns.getRecords(ctx, &netbox.RecordQuery{
+		FQDN: name,
+		Type: []string{"DS"},
+		Zone: zone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 {
+		return recordsToRR(records)
+	}
+	chain, err := netboxdns.zoneNSEC(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	nsec := chain.match(name)
+	if fqdnKey(nsec.Hdr.Name) != fqdnKey(name) {
+		return nil, nil
+	}
+	return []dns.RR{dns.Copy(nsec)}, nil
+}
+
+// belowDelegation reports whether name is below one of the delegation points
+func belowDelegation(name string, delegations []string) bool {
+	for _, delegation := range delegations {
+		if name != delegation && dns.IsSubDomain(delegation, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentName returns name with its first label removed
+func parentName(name string) string {
+	next, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[next:]
+}
+
+// canonicalLess reports whether a sorts before b in canonical DNS name order
+// as defined in RFC 4034 section 6.1
+func canonicalLess(a string, b string) bool {
+	labelsA := dns.SplitDomainName(strings.ToLower(a))
+	labelsB := dns.SplitDomainName(strings.ToLower(b))
+	for i := 1; i <= len(labelsA) && i <= len(labelsB); i++ {
+		labelA := labelsA[len(labelsA)-i]
+		labelB := labelsB[len(labelsB)-i]
+		if labelA != labelB {
+			return labelA < labelB
+		}
+	}
+	return len(labelsA) < len(labelsB)
+}
+
+// serveDNSKEY answers a DNSKEY query at the apex of a signed zone
+func (netboxdns *NetboxDNS) serveDNSKEY(
+	writer dns.ResponseWriter,
+	request *dns.Msg,
+	zone string,
+	do bool,
+) (int, error) {
+	msg := new(dns.Msg)
+	msg.SetReply(request)
+	msg.Authoritative = true
+	msg.Answer = netboxdns.dnssec.dnskeys(zone)
+	if do {
+		answer, err := netboxdns.dnssec.signSection(zone, msg.Answer, "", "")
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		msg.Answer = answer
+	}
+	writer.WriteMsg(msg)
+	return dns.RcodeSuccess, nil
+}
@@ -0,0 +1,252 @@
+package netboxdns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const (
+	testKSK string = ".testing/dnssec/Kexample.com.+013+13083"
+	testZSK string = ".testing/dnssec/Kexample.com.+013+03148"
+)
+
+func TestDNSSECSignRRset(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	a, _ := dns.NewRR("web.example.com. 3600 IN A 10.0.0.17")
+	sigs, err := netboxdns.dnssec.signRRset("example.com.", []dns.RR{a})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(sigs))
+	}
+	sig := sigs[0].(*dns.RRSIG)
+	zsk, _ := readZoneKey(testZSK)
+	if sig.KeyTag != zsk.tag {
+		t.Errorf("A record signed with key %d, want zone signing key %d", sig.KeyTag, zsk.tag)
+	}
+	if err := sig.Verify(zsk.dnskey, []dns.RR{a}); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	cached, _ := netboxdns.dnssec.signRRset("example.com.", []dns.RR{a})
+	if cached[0].(*dns.RRSIG).Signature != sig.Signature {
+		t.Error("signature not served from cache")
+	}
+
+	dnskeys := netboxdns.dnssec.dnskeys("example.com.")
+	sigs, err = netboxdns.dnssec.signRRset("example.com.", dnskeys)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ksk, _ := readZoneKey(testKSK)
+	if len(sigs) != 1 || sigs[0].(*dns.RRSIG).KeyTag != ksk.tag {
+		t.Errorf("DNSKEY not signed with key signing key: %v", sigs)
+	}
+}
+
+func TestDNSSECSignSection(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	ns1, _ := dns.NewRR("example.com. 3600 IN NS dns01.example.com.")
+	ns2, _ := dns.NewRR("example.com. 3600 IN NS dns02.example.com.")
+	delegation, _ := dns.NewRR("sub.example.com. 3600 IN NS dns01.example.net.")
+	glue, _ := dns.NewRR("dns01.example.net. 3600 IN A 192.0.2.1")
+	out, err := netboxdns.dnssec.signSection("example.com.", []dns.RR{ns1, ns2, delegation, glue}, "", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var sigs []*dns.RRSIG
+	for _, rr := range out {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) != 1 || sigs[0].Hdr.Name != "example.com." {
+		t.Errorf("expected a single signature of the apex NS RRset, got %v", sigs)
+	}
+}
+
+func TestDNSSECDenial(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	zone, _ := netboxdns.snapshot.getZone(1)
+	tests := []struct {
+		name        string
+		qname       string
+		synthesized bool
+		want        []string
+	}{
+		{"nxdomain covered by apex", "aaa.example.com.", false, []string{"example.com."}},
+		{"nxdomain after last name", "zzz.example.com.", false, []string{"www.example.com.", "example.com."}},
+		{"nodata", "web.example.com.", false, []string{"web.example.com."}},
+		{"wildcard answer", "zzz.example.com.", true, []string{"www.example.com."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrs, err := netboxdns.denial(context.Background(), &zone, tt.qname, tt.synthesized)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var got []string
+			for _, rr := range rrs {
+				got = append(got, rr.Header().Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got NSEC owners %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	chain, err := netboxdns.zoneNSEC(context.Background(), &zone)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	apex := chain.match("example.com.")
+	if apex.NextDomain != "a.b.example.com." {
+		t.Errorf("got next name %q, want a.b.example.com.", apex.NextDomain)
+	}
+	if !slices.Contains(apex.TypeBitMap, dns.TypeDNSKEY) || !slices.Contains(apex.TypeBitMap, dns.TypeSOA) {
+		t.Errorf("apex NSEC does not list SOA and DNSKEY: %v", apex)
+	}
+	if apex.Hdr.Ttl != 3600 {
+		t.Errorf("got NSEC TTL %d, want SOA minimum 3600", apex.Hdr.Ttl)
+	}
+}
+
+func TestDNSSECChainCache(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	zone, _ := netboxdns.snapshot.getZone(1)
+	chain, err := netboxdns.zoneNSEC(context.Background(), &zone)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cached, _ := netboxdns.zoneNSEC(context.Background(), &zone)
+	if &cached[0] != &chain[0] {
+		t.Error("NSEC chain was built again for an unchanged zone")
+	}
+
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 30, Name: "new", Type: "A", Value: "10.0.0.40", FQDN: "new.example.com.", Zone: zone})
+	chain, _ = netboxdns.zoneNSEC(context.Background(), &zone)
+	if !chain.exists("new.example.com.") {
+		t.Error("NSEC chain does not include a record added to the zone")
+	}
+}
+
+func TestCanonicalLess(t *testing.T) {
+	ordered := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		"*.z.example.",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		if !canonicalLess(ordered[i], ordered[i+1]) {
+			t.Errorf("%q does not sort before %q", ordered[i], ordered[i+1])
+		}
+		if canonicalLess(ordered[i+1], ordered[i]) {
+			t.Errorf("%q sorts before %q", ordered[i+1], ordered[i])
+		}
+	}
+}
+
+func TestDNSSECNegativeTTL(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	zone, _ := netboxdns.snapshot.getZone(1)
+	ttl := uint32(7200)
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 1, Name: "@", Type: "SOA", Value: "dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600", FQDN: "example.com.", Zone: zone, TTL: &ttl})
+
+	req := new(dns.Msg)
+	req.SetQuestion("foo.example.com.", dns.TypeA)
+	req.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var soa *dns.SOA
+	var sig *dns.RRSIG
+	for _, rr := range rec.Msg.Ns {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			soa = rr
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeSOA {
+				sig = rr
+			}
+		}
+	}
+	if soa == nil || sig == nil {
+		t.Fatalf("expected a signed SOA in the authority section, got %v", rec.Msg.Ns)
+	}
+	if soa.Hdr.Ttl != 3600 || sig.Hdr.Ttl != 3600 {
+		t.Errorf("got SOA TTL %d and RRSIG TTL %d, want the SOA minimum 3600", soa.Hdr.Ttl, sig.Hdr.Ttl)
+	}
+	// the signature covers the SOA as it is in the zone
+	if sig.OrigTtl != 7200 {
+		t.Errorf("got original TTL %d, want the SOA TTL 7200", sig.OrigTtl)
+	}
+	zsk, _ := readZoneKey(testZSK)
+	if err := sig.Verify(zsk.dnskey, []dns.RR{soa}); err != nil {
+		t.Errorf("signature of the negative SOA does not verify: %v", err)
+	}
+}
+
+func TestDNSSECReferral(t *testing.T) {
+	netboxdns := newTestPlugin(t, withDNSSEC())
+	zone, _ := netboxdns.snapshot.getZone(1)
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 40, Name: "child", Type: "NS", Value: "ns.child.example.com.", FQDN: "child.example.com.", Zone: zone})
+
+	referral := func() map[uint16][]dns.RR {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion("child.example.com.", dns.TypeA)
+		req.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if rec.Msg.Authoritative {
+			t.Error("referral is authoritative")
+		}
+		out := make(map[uint16][]dns.RR)
+		for _, rr := range rec.Msg.Ns {
+			rrtype := rr.Header().Rrtype
+			if sig, ok := rr.(*dns.RRSIG); ok {
+				rrtype = sig.TypeCovered
+			}
+			out[rrtype] = append(out[rrtype], rr)
+		}
+		return out
+	}
+
+	// an unsigned delegation is proven insecure by the NSEC of its name
+	ns := referral()
+	if len(ns[dns.TypeNS]) != 1 {
+		t.Errorf("expected the unsigned NS record, got %v", ns[dns.TypeNS])
+	}
+	nsec := ns[dns.TypeNSEC]
+	if len(nsec) != 2 || nsec[0].Header().Name != "child.example.com." {
+		t.Fatalf("expected the signed NSEC of child.example.com., got %v", nsec)
+	}
+	bitmap := nsec[0].(*dns.NSEC).TypeBitMap
+	if !slices.Contains(bitmap, dns.TypeNS) || slices.Contains(bitmap, dns.TypeDS) {
+		t.Errorf("got NSEC types %v, want NS without DS", bitmap)
+	}
+
+	// a signed delegation is proven by its DS RRset
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 41, Name: "child", Type: "DS", Value: "12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF", FQDN: "child.example.com.", Zone: zone})
+	ns = referral()
+	if len(ns[dns.TypeDS]) != 2 {
+		t.Errorf("expected the signed DS record, got %v", ns[dns.TypeDS])
+	}
+	if len(ns[dns.TypeNSEC]) != 0 {
+		t.Errorf("expected no NSEC for a signed delegation, got %v", ns[dns.TypeNSEC])
+	}
+}
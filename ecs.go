@@ -0,0 +1,142 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/miekg/dns"
+)
+
+// ecsConfig selects views by the EDNS0 Client Subnet option (RFC 7871) of
+// requests instead of the address of the resolver sending them
+type ecsConfig struct {
+	// trusted are the resolvers the option is accepted from. A client could
+	// otherwise claim an address in any view.
+	trusted []netip.Prefix
+}
+
+func (ecs *ecsConfig) trusts(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range ecs.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientSubnet returns the client subnet option of reqMsg and its prefix if
+// the option is to be used for view selection
+func (netboxdns *NetboxDNS) clientSubnet(
+	reqMsg *dns.Msg,
+	reqIP netip.Addr,
+) (*dns.EDNS0_SUBNET, netip.Prefix, bool) {
+	if netboxdns.ecs == nil || !netboxdns.ecs.trusts(reqIP) {
+		return nil, netip.Prefix{}, false
+	}
+	opt := reqMsg.IsEdns0()
+	if opt == nil {
+		return nil, netip.Prefix{}, false
+	}
+	for _, option := range opt.Option {
+		subnet, ok := option.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+		prefix, ok := subnetPrefix(subnet)
+		if !ok {
+			logger.Debugf("ignoring invalid client subnet from %v", reqIP)
+			return nil, netip.Prefix{}, false
+		}
+		return subnet, prefix, true
+	}
+	return nil, netip.Prefix{}, false
+}
+
+// subnetPrefix returns the address of subnet masked to its source prefix
+// length
+func subnetPrefix(subnet *dns.EDNS0_SUBNET) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(subnet.Address)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	switch {
+	case subnet.Family == 1 && !addr.Is4():
+		return netip.Prefix{}, false
+	case subnet.Family == 2 && !addr.Is6():
+		return netip.Prefix{}, false
+	case subnet.Family != 1 && subnet.Family != 2:
+		return netip.Prefix{}, false
+	}
+	prefix, err := addr.Prefix(int(subnet.SourceNetmask))
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
+// ecsScope returns the scope prefix length of an answer for the client
+// subnet. It is the shortest prefix length at which no view prefix splits the
+// subnet, so every client sharing it is given the same views.
+func (netboxdns *NetboxDNS) ecsScope(ctx context.Context, subnet netip.Prefix) (int, error) {
+	var prefixes []netip.Prefix
+	views, err := netboxdns.zoneViews(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, view := range views {
+		for _, prefixObj := range view.Prefixes {
+			prefix, err := netip.ParsePrefix(prefixObj.Prefix)
+			if err != nil {
+				return 0, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return splitScope(subnet.Addr(), prefixes), nil
+}
+
+// splitScope returns the shortest prefix length of addr that contains no
+// longer prefix of prefixes
+func splitScope(addr netip.Addr, prefixes []netip.Prefix) int {
+	for bits := 0; bits < addr.BitLen(); bits++ {
+		scope := netip.PrefixFrom(addr, bits).Masked()
+		split := false
+		for _, prefix := range prefixes {
+			if prefix.Bits() > bits && scope.Overlaps(prefix) {
+				split = true
+				break
+			}
+		}
+		if !split {
+			return bits
+		}
+	}
+	return addr.BitLen()
+}
+
+// setClientSubnet echoes subnet in respMsg with the given scope prefix length
+func setClientSubnet(
+	respMsg *dns.Msg,
+	reqMsg *dns.Msg,
+	subnet *dns.EDNS0_SUBNET,
+	scope int,
+) {
+	opt := respMsg.IsEdns0()
+	if opt == nil {
+		opt = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		opt.SetUDPSize(reqMsg.IsEdns0().UDPSize())
+		if reqMsg.IsEdns0().Do() {
+			opt.SetDo()
+		}
+		respMsg.Extra = append(respMsg.Extra, opt)
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        subnet.Family,
+		SourceNetmask: subnet.SourceNetmask,
+		SourceScope:   uint8(scope),
+		Address:       subnet.Address,
+	})
+}
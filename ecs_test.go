@@ -0,0 +1,120 @@
+package netboxdns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestECSViewSelection(t *testing.T) {
+	// the address of test.ResponseWriter
+	resolver := []netip.Prefix{netip.MustParsePrefix("10.240.0.1/32")}
+	tests := []struct {
+		name    string
+		trusted []netip.Prefix
+		subnet  *dns.EDNS0_SUBNET
+		answer  string
+		scope   int
+	}{
+		{
+			name:    "no client subnet",
+			trusted: resolver,
+			answer:  "web.example.com. 3600 IN A 10.0.0.17",
+			scope:   -1,
+		},
+		{
+			name:    "client subnet",
+			trusted: resolver,
+			subnet:  &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")},
+			answer:  "web.example.com. 3600 IN A 192.0.2.17",
+			scope:   24,
+		},
+		{
+			name:    "client subnet narrower than view",
+			trusted: resolver,
+			subnet:  &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 32, Address: net.ParseIP("10.1.2.3")},
+			answer:  "web.example.com. 3600 IN A 10.0.0.17",
+			scope:   8,
+		},
+		{
+			name:    "source prefix length zero",
+			trusted: resolver,
+			subnet:  &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 0, Address: net.ParseIP("0.0.0.0")},
+			answer:  "web.example.com. 3600 IN A 10.0.0.17",
+			scope:   0,
+		},
+		{
+			name:   "no trusted resolvers",
+			subnet: &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")},
+			answer: "web.example.com. 3600 IN A 10.0.0.17",
+			scope:  -1,
+		},
+		{
+			name:    "untrusted resolver",
+			trusted: []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")},
+			subnet:  &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")},
+			answer:  "web.example.com. 3600 IN A 10.0.0.17",
+			scope:   -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t, withBranchView())
+			netboxdns.ecs = &ecsConfig{trusted: tt.trusted}
+			req := new(dns.Msg)
+			req.SetQuestion("web.example.com.", dns.TypeA)
+			if tt.subnet != nil {
+				req.SetEdns0(4096, false)
+				tt.subnet.Code = dns.EDNS0SUBNET
+				req.IsEdns0().Option = append(req.IsEdns0().Option, tt.subnet)
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].String() != test.A(tt.answer).String() {
+				t.Errorf("got answer %v, want %s", rec.Msg.Answer, tt.answer)
+			}
+			scope := -1
+			if opt := rec.Msg.IsEdns0(); opt != nil {
+				for _, option := range opt.Option {
+					if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+						scope = int(subnet.SourceScope)
+					}
+				}
+			}
+			if scope != tt.scope {
+				t.Errorf("got scope prefix length %d, want %d", scope, tt.scope)
+			}
+		})
+	}
+}
+
+func TestECSSplitScope(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	tests := []struct {
+		addr string
+		want int
+	}{
+		{"192.0.2.0", 24},
+		{"10.1.2.0", 8},
+		{"198.51.100.0", 6},
+		{"2001:db8:1::", 32},
+		{"2001:db9::", 32},
+		{"fe80::", 1},
+	}
+	for _, tt := range tests {
+		if got := splitScope(netip.MustParseAddr(tt.addr), prefixes); got != tt.want {
+			t.Errorf("splitScope(%s) = %d, want %d", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package netboxdns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+// testPluginOption adds a feature or fixture to the plugin built by
+// newTestPlugin
+type testPluginOption func(t *testing.T, netboxdns *NetboxDNS)
+
+// newTestPlugin returns a plugin answering from the test snapshot with a
+// default view that matches every client, changed by opts in order
+func newTestPlugin(t *testing.T, opts ...testPluginOption) *NetboxDNS {
+	t.Helper()
+	snap := testSnapshot()
+	snap.putView(netbox.View{
+		ID:       1,
+		Name:     "default",
+		Default:  true,
+		Prefixes: []netbox.Prefix{{ID: 1, Prefix: "0.0.0.0/0"}, {ID: 2, Prefix: "::/0"}},
+	})
+	zone, _ := snap.getZone(1)
+	snap.putRecord(netbox.Record{ID: 6, Name: "a.b", Type: "A", Value: "10.0.0.30", FQDN: "a.b.example.com.", Zone: zone})
+
+	netboxdns := NewNetboxDNS()
+	netboxdns.Next = test.ErrorHandler()
+	netboxdns.snapshot = snap
+	for _, opt := range opts {
+		opt(t, netboxdns)
+	}
+	return netboxdns
+}
+
+// withBranchView limits the default view to 10.0.0.0/8 and adds a branch
+// view for 192.0.2.0/24 with its own example.com
+func withBranchView() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		netboxdns.snapshot.putView(netbox.View{
+			ID:       1,
+			Name:     "default",
+			Default:  true,
+			Prefixes: []netbox.Prefix{{ID: 1, Prefix: "10.0.0.0/8"}},
+		})
+		netboxdns.snapshot.putView(netbox.View{
+			ID:       2,
+			Name:     "branch",
+			Prefixes: []netbox.Prefix{{ID: 2, Prefix: "192.0.2.0/24"}},
+		})
+		zone := netbox.Zone{ID: 10, Name: "example.com", DefaultTTL: 3600}
+		zone.View.ID = 2
+		netboxdns.snapshot.putZone(zone)
+		netboxdns.snapshot.putRecord(netbox.Record{ID: 40, Name: "web", Type: "A", Value: "192.0.2.17", FQDN: "web.example.com.", Zone: zone})
+	}
+}
+
+// withInternalView adds an internal view for 10.0.0.0/8 with its own
+// example.com at serial 7
+func withInternalView() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		internal := netbox.Zone{ID: 3, Name: "example.com", DefaultTTL: 3600}
+		internal.View.ID = 2
+		internal.View.Name = "internal"
+		netboxdns.snapshot.putView(netbox.View{
+			ID:       2,
+			Name:     "internal",
+			Prefixes: []netbox.Prefix{{ID: 3, Prefix: "10.0.0.0/8"}},
+		})
+		netboxdns.snapshot.putZone(internal)
+		netboxdns.snapshot.setZoneRecords(internal.ID, []netbox.Record{
+			{ID: 10, Name: "@", Type: "SOA", Value: "dns01.example.com. admin.example.com. 7 43200 7200 2419200 3600", FQDN: "example.com.", Zone: internal},
+			{ID: 11, Name: "intranet", Type: "A", Value: "10.1.1.1", FQDN: "intranet.example.com.", Zone: internal},
+		})
+	}
+}
+
+// withWildcards adds wildcard records to example.com
+func withWildcards() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		zone, _ := netboxdns.snapshot.getZone(1)
+		netboxdns.snapshot.putRecord(netbox.Record{ID: 20, Name: "*", Type: "A", Value: "10.0.0.99", FQDN: "*.example.com.", Zone: zone})
+		netboxdns.snapshot.putRecord(netbox.Record{ID: 21, Name: "*.b", Type: "CNAME", Value: "web", FQDN: "*.b.example.com.", Zone: zone})
+		netboxdns.snapshot.putRecord(netbox.Record{ID: 22, Name: "*.a.b", Type: "TXT", Value: "wildcard", FQDN: "*.a.b.example.com.", Zone: zone})
+	}
+}
+
+// withDNSSEC signs example.com with the test keys
+func withDNSSEC() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		t.Helper()
+		netboxdns.dnssec = newDNSSECSigner()
+		for _, base := range []string{testKSK, testZSK} {
+			key, err := readZoneKey(base)
+			if err != nil {
+				t.Fatalf("could not read key %s: %v", base, err)
+			}
+			if err := netboxdns.dnssec.addKey("example.com.", key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// withIPAM serves records for IPAM addresses in example.com and
+// 10.in-addr.arpa, which has the reverse zone 0.0.10.in-addr.arpa
+func withIPAM(precedence ipamPrecedence) testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		reverse := netbox.Zone{ID: 4, Name: "0.0.10.in-addr.arpa", DefaultTTL: 600}
+		reverse.View.ID = 1
+		netboxdns.snapshot.putZone(reverse)
+		netboxdns.ipam = newIPAMSource()
+		netboxdns.ipam.zones = []string{"example.com.", "10.in-addr.arpa."}
+		netboxdns.ipam.precedence = precedence
+		ipAddresses := []netbox.IPAddress{
+			{ID: 1, Address: "10.0.0.50/24", DNSName: "printer.example.com"},
+			{ID: 2, Address: "10.0.0.51/24", DNSName: "web.example.com"},
+			{ID: 3, Address: "2001:db8::52/64", DNSName: "Host.Sub.example.com"},
+			{ID: 4, Address: "10.0.0.53/24", DNSName: "other.example.net"},
+			{ID: 5, Address: "10.0.0.54/24"},
+		}
+		zones := netboxdns.snapshot.getZones()
+		netboxdns.ipam.records.set(zones, nil, netboxdns.ipam.buildRecords(ipAddresses, zones))
+	}
+}
+
+// withTSIG configures the keys transfer.key, which may transfer and query
+// example.com, and other.key, which may only query it
+func withTSIG() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		netboxdns.tsig = newTSIGConfig()
+		netboxdns.tsig.secrets["transfer.key."] = "c2VjcmV0"
+		netboxdns.tsig.secrets["other.key."] = "b3RoZXI="
+		netboxdns.tsig.acls = []tsigACL{
+			{
+				zone:      "example.com.",
+				operation: tsigOperationTransfer,
+				keys:      map[string]bool{"transfer.key.": true},
+			},
+			{
+				zone:      "example.com.",
+				operation: tsigOperationQuery,
+				keys:      map[string]bool{"transfer.key.": true, "other.key.": true},
+			},
+		}
+	}
+}
+
+// withUpdates accepts updates for example.com and writes them to a records API
+// serving the records of the snapshot, which is stored in api
+func withUpdates(api **testRecordsAPI) testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		netboxdns.updates = &updateConfig{zones: []string{"example.com."}}
+		*api = newTestRecordsAPI(netboxdns.snapshot.getRecords(&netbox.RecordQuery{}))
+		withAPI(*api)(t, netboxdns)
+	}
+}
+
+// withBlockingAPI replaces the snapshot with an empty one and sends queries
+// for example.com to Netbox, whose requests block until they are cancelled
+func withBlockingAPI() testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		netboxdns.snapshot = newSnapshot()
+		netboxdns.zones = []string{"example.com."}
+		withAPI(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			<-request.Context().Done()
+		}))(t, netboxdns)
+	}
+}
+
+// withAPI sends the Netbox requests of the plugin to handler
+func withAPI(handler http.Handler) testPluginOption {
+	return func(t *testing.T, netboxdns *NetboxDNS) {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+		netboxdns.requestClient = &netbox.APIRequestClient{
+			Client:    server.Client(),
+			NetboxURL: netboxURL,
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package netboxdns
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const (
+	hostKindDevices         string = "devices"
+	hostKindVirtualMachines string = "virtual_machines"
+
+	// defaultHostTemplate appends the site of hosts that have one, which
+	// virtual machines may not
+	defaultHostTemplate string = "{{.Name}}{{with .Site}}.{{.Slug}}{{end}}"
+)
+
+// hostSource serves A and AAAA records for the primary IP addresses of
+// devices or virtual machines. The name of a host is its template rendered
+// with the device or virtual machine, followed by zone.
+type hostSource struct {
+	kind     string
+	zone     string
+	template *template.Template
+	query    netbox.HostQuery
+	// records holds the records created from hosts
+	records *snapshot
+	// names maps host IDs to the names given to them at the last reload
+	names map[int]string
+}
+
+func newHostSource(kind string, zone string) *hostSource {
+	return &hostSource{
+		kind:     kind,
+		zone:     zone,
+		template: template.Must(template.New(kind).Parse(defaultHostTemplate)),
+		records:  newSnapshot(),
+	}
+}
+
+// syncHosts reloads the hosts of source from Netbox and rebuilds their
+// records
+func (netboxdns *NetboxDNS) syncHosts(ctx context.Context, source *hostSource) error {
+	var hosts []any
+	switch source.kind {
+	case hostKindDevices:
+		devices, err := netbox.GetDevices(ctx, netboxdns.requestClient, &source.query)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			hosts = append(hosts, device)
+		}
+	case hostKindVirtualMachines:
+		virtualMachines, err := netbox.GetVirtualMachines(
+			ctx,
+			netboxdns.requestClient,
+			&source.query,
+		)
+		if err != nil {
+			return err
+		}
+		for _, virtualMachine := range virtualMachines {
+			hosts = append(hosts, virtualMachine)
+		}
+	}
+	zones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return err
+	}
+	records := source.buildRecords(hosts, zones)
+	setSourceRecords(source.records, records)
+	logger.Infof(
+		"loaded %d %s as %d records in %q",
+		len(hosts),
+		source.kind,
+		len(records),
+		source.zone,
+	)
+	return nil
+}
+
+// buildRecords returns the records for hosts, which are devices or virtual
+// machines, in the most specific zones containing their names. The names are
+// remembered for the targets of services.
+func (source *hostSource) buildRecords(hosts []any, zones []netbox.Zone) []netbox.Record {
+	var out []netbox.Record
+	source.names = make(map[int]string, len(hosts))
+	for _, host := range hosts {
+		name, err := source.hostName(host)
+		if err != nil {
+			logger.Debugf("ignoring host in %s: %v", source.kind, err)
+			continue
+		}
+		common := commonHost(host)
+		source.names[common.ID] = name
+		for _, address := range hostAddresses(common) {
+			ipAddress := netbox.IPAddress{Address: address.Address}
+			addr, err := ipAddress.Addr()
+			if err != nil {
+				continue
+			}
+			addr = addr.Unmap()
+			rrtype := "A"
+			if addr.Is6() {
+				rrtype = "AAAA"
+			}
+			for _, zone := range closestZones(name, zones) {
+				out = append(out, netbox.Record{
+					ID:    -len(out) - 1,
+					Name:  relativeName(name, zone.Name),
+					Type:  rrtype,
+					Value: addr.String(),
+					Zone:  zone,
+					FQDN:  name,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// hostName renders the name of host. Labels are lowercased and spaces and
+// underscores replaced with hyphens, as they are common in Netbox names.
+func (source *hostSource) hostName(host any) (string, error) {
+	var rendered strings.Builder
+	if err := source.template.Execute(&rendered, host); err != nil {
+		return "", err
+	}
+	label := strings.ToLower(strings.TrimSuffix(rendered.String(), "."))
+	label = strings.NewReplacer(" ", "-", "_", "-").Replace(label)
+	name := dns.Fqdn(label + "." + source.zone)
+	// empty values in the template leave empty labels behind
+	if label == "" || strings.HasPrefix(label, ".") || strings.Contains(label, "..") {
+		return "", &hostNameError{name: name}
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return "", &hostNameError{name: name}
+	}
+	return fqdnKey(name), nil
+}
+
+// objectType returns the Netbox object type of the hosts of source
+func (source *hostSource) objectType() string {
+	if source.kind == hostKindVirtualMachines {
+		return netbox.ObjectTypeVirtualMachine
+	}
+	return netbox.ObjectTypeDevice
+}
+
+func commonHost(host any) netbox.Host {
+	switch h := host.(type) {
+	case netbox.Device:
+		return h.Host
+	case netbox.VirtualMachine:
+		return h.Host
+	}
+	return netbox.Host{}
+}
+
+func hostAddresses(host netbox.Host) []*netbox.NestedIPAddress {
+	var out []*netbox.NestedIPAddress
+	for _, address := range []*netbox.NestedIPAddress{host.PrimaryIP4, host.PrimaryIP6} {
+		if address != nil {
+			out = append(out, address)
+		}
+	}
+	return out
+}
+
+type hostNameError struct {
+	name string
+}
+
+func (err *hostNameError) Error() string {
+	return "invalid host name " + err.name
+}
@@ -0,0 +1,101 @@
+package netboxdns
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"text/template"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+func TestHostsBuildRecords(t *testing.T) {
+	zones := testSnapshot().getZones()
+	site := &netbox.NestedObject{ID: 1, Name: "Main Site", Slug: "main"}
+	devices := []any{
+		netbox.Device{Host: netbox.Host{
+			ID:         1,
+			Name:       "Core Switch_1",
+			Site:       site,
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 1, Address: "10.0.0.1/24"},
+			PrimaryIP6: &netbox.NestedIPAddress{ID: 2, Address: "2001:db8::1/64"},
+		}},
+		// the default template leaves out a missing site
+		netbox.Device{Host: netbox.Host{
+			ID:         2,
+			Name:       "orphan",
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 3, Address: "10.0.0.2/24"},
+		}},
+		// unnamed devices cannot be resolved
+		netbox.Device{Host: netbox.Host{
+			ID:         3,
+			Site:       site,
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 4, Address: "10.0.0.3/24"},
+		}},
+	}
+	source := newHostSource(hostKindDevices, "example.com.")
+	var got []string
+	for _, record := range source.buildRecords(devices, zones) {
+		got = append(got, record.Zone.Name+" "+record.Name+" "+record.Type+" "+record.Value)
+	}
+	want := []string{
+		"example.com core-switch-1.main A 10.0.0.1",
+		"example.com core-switch-1.main AAAA 2001:db8::1",
+		"example.com orphan A 10.0.0.2",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+
+	virtualMachines := []any{
+		netbox.VirtualMachine{
+			Host: netbox.Host{
+				ID:         1,
+				Name:       "host",
+				PrimaryIP4: &netbox.NestedIPAddress{ID: 5, Address: "10.0.1.20/24"},
+			},
+			Cluster: &netbox.NestedObject{ID: 1, Name: "vm", Slug: "vm"},
+		},
+	}
+	// virtual machines need not have a site
+	source = newHostSource(hostKindVirtualMachines, "example.com.")
+	records := source.buildRecords(virtualMachines, zones)
+	if len(records) != 1 || records[0].FQDN != "host.example.com." {
+		t.Errorf("got records %v for a virtual machine without a site, want host.example.com.", records)
+	}
+
+	source.template = template.Must(template.New("").Parse("{{.Name}}-{{.Cluster.Slug}}.sub"))
+	records = source.buildRecords(virtualMachines, zones)
+	if len(records) != 1 || records[0].FQDN != "host-vm.sub.example.com." || records[0].Zone.ID != 2 {
+		t.Errorf("virtual machine record not in most specific zone: %v", records)
+	}
+}
+
+func TestHostsMergeRecords(t *testing.T) {
+	netboxdns := newTestPlugin(t)
+	source := newHostSource(hostKindDevices, "example.com.")
+	source.template = template.Must(template.New("").Parse("{{.Name}}"))
+	zones := netboxdns.snapshot.getZones()
+	setSourceRecords(source.records, source.buildRecords([]any{
+		netbox.Device{Host: netbox.Host{
+			ID:         1,
+			Name:       "web",
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 1, Address: "10.0.0.99/24"},
+		}},
+		netbox.Device{Host: netbox.Host{
+			ID:         2,
+			Name:       "switch",
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 2, Address: "10.0.0.98/24"},
+		}},
+	}, zones))
+	netboxdns.hosts = []*hostSource{source}
+
+	records, _ := netboxdns.getRecords(context.Background(), &netbox.RecordQuery{FQDN: "web.example.com", Type: []string{"A"}})
+	if len(records) != 1 || records[0].Value != "10.0.0.17" {
+		t.Errorf("device record replaced record in Netbox: %v", records)
+	}
+	records, _ = netboxdns.getRecords(context.Background(), &netbox.RecordQuery{FQDN: "switch.example.com", Type: []string{"A"}})
+	if len(records) != 1 || records[0].Value != "10.0.0.98" {
+		t.Errorf("device record not served: %v", records)
+	}
+}
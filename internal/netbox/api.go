@@ -1,21 +1,75 @@
 package netbox
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
+// bulkPageLimit is the page size requested when fetching entire object lists.
+// It matches the default MAX_PAGE_SIZE of Netbox.
+const bulkPageLimit int = 1000
+
 type APIRequestClient struct {
-	Client    *http.Client
+	Client *http.Client
+	// NetboxURL is the root of the netbox-plugin-dns API
 	NetboxURL *url.URL
+	// APIURL is the root of the Netbox API, used for core endpoints
+	APIURL    *url.URL
 	Token     string
 	UserAgent string
+	// Retry retries failed GET requests when not nil
+	Retry *RetryPolicy
+	// Breaker stops requests while Netbox is failing when not nil
+	Breaker *CircuitBreaker
 }
 
 type APIResultModel interface {
-	Record | Zone | View
+	Record | Zone | View | ObjectChange | IPAddress | Device | VirtualMachine |
+		Service
+}
+
+// APIError is returned when Netbox responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Detail is the start of the response body
+	Detail string
+}
+
+func (err *APIError) Error() string {
+	if err.Detail != "" {
+		return fmt.Sprintf(
+			"request error [%d] %q: %s",
+			err.StatusCode,
+			err.Status,
+			err.Detail,
+		)
+	}
+	return fmt.Sprintf(
+		"request error [%d] %q",
+		err.StatusCode,
+		err.Status,
+	)
+}
+
+// IsNotFound reports whether err is an APIError for a missing object
+func IsNotFound(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) &&
+		apiError.StatusCode == http.StatusNotFound
 }
 
 type APIManyResponse[T APIResultModel] struct {
@@ -25,11 +79,23 @@ type APIManyResponse[T APIResultModel] struct {
 	Results  []T    `json:"results"`
 }
 
-func doGet(
+// doRequest sends a request with body encoded as JSON, unless it is nil
+func doRequest(
+	ctx context.Context,
 	requestClient *APIRequestClient,
+	method string,
 	url string,
+	body any,
 ) (*http.Response, error) {
-	request, err := http.NewRequest("GET", url, nil)
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, err
 	}
@@ -40,27 +106,88 @@ func doGet(
 	)
 
 	request.Header.Set("User-Agent", requestClient.UserAgent)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+
+	// the span ends when the body is closed, so it covers reading and
+	// decoding the response
+	name := endpoint(url)
+	span, _ := StartSpan(ctx, "netbox "+method+" "+name)
+	ext.SpanKindRPCClient.Set(span)
+	ext.HTTPMethod.Set(span, method)
+	ext.HTTPUrl.Set(span, url)
+	// Netbox is usually not traced, but a proxy in front of it may be
+	span.Tracer().Inject(
+		span.Context(),
+		ot.HTTPHeaders,
+		ot.HTTPHeadersCarrier(request.Header),
+	)
+
+	if err := requestClient.Breaker.allow(); err != nil {
+		ext.Error.Set(span, true)
+		ext.LogError(span, err)
+		span.Finish()
+		return nil, err
+	}
+	start := time.Now()
+	response, err := requestClient.Client.Do(request)
+	requestClient.Breaker.done(ctx, response, err)
+	requestDuration.WithLabelValues(name, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(name, "error").Inc()
+		ext.Error.Set(span, true)
+		ext.LogError(span, err)
+		span.Finish()
+		return nil, err
+	}
+	ext.HTTPStatusCode.Set(span, uint16(response.StatusCode))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		requestErrors.WithLabelValues(name, strconv.Itoa(response.StatusCode)).Inc()
+		ext.Error.Set(span, true)
+	}
+	response.Body = &tracedBody{ReadCloser: response.Body, span: span}
+	return response, nil
+}
+
+// tracedBody finishes the span of a request when its response body is closed
+type tracedBody struct {
+	io.ReadCloser
+	span ot.Span
+	once sync.Once
+}
 
-	return requestClient.Client.Do(request)
+func (body *tracedBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.span.Finish)
+	return err
 }
 
 func responseError(response *http.Response) error {
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf(
-			"request error [%d] %q",
-			response.StatusCode,
-			response.Status,
-		)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// Netbox explains rejected writes in the body
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		err := &APIError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Detail:     strings.TrimSpace(string(detail)),
+		}
+		if body, ok := response.Body.(*tracedBody); ok {
+			ext.LogError(body.span, err)
+		}
+		return err
 	}
 	return nil
 }
 
 func get[T APIResultModel](
+	ctx context.Context,
 	requestClient *APIRequestClient,
 	url string,
 ) (T, error) {
 	var out T
-	response, err := doGet(requestClient, url)
+	response, err := doGet(ctx, requestClient, url)
 	if err != nil {
 		return out, err
 	}
@@ -75,29 +202,51 @@ func get[T APIResultModel](
 	return out, nil
 }
 
+func getPage[T APIResultModel](
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	url string,
+) (APIManyResponse[T], error) {
+	var apiResponse APIManyResponse[T]
+	response, err := doGet(ctx, requestClient, url)
+	if err != nil {
+		return apiResponse, err
+	}
+	defer response.Body.Close()
+
+	if err := responseError(response); err != nil {
+		return apiResponse, err
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	if err := decoder.Decode(&apiResponse); err != nil {
+		return apiResponse, fmt.Errorf("could not unmarshal response: %w", err)
+	}
+	return apiResponse, nil
+}
+
 func getMany[T APIResultModel](
+	ctx context.Context,
 	requestClient *APIRequestClient,
 	url string,
 ) ([]T, error) {
 	nextUrl := url
 	var out []T
+	pages := 0
+	defer func() {
+		listPages.WithLabelValues(endpoint(url)).Observe(float64(pages))
+	}()
 
 	for nextUrl != "" {
-		response, err := doGet(requestClient, nextUrl)
-		if err != nil {
+		// stop paging once the caller is no longer waiting for the results
+		if err := ctx.Err(); err != nil {
 			return out, err
 		}
-		defer response.Body.Close()
-
-		if err := responseError(response); err != nil {
+		apiResponse, err := getPage[T](ctx, requestClient, nextUrl)
+		if err != nil {
 			return out, err
 		}
-
-		var apiResponse APIManyResponse[T]
-		decoder := json.NewDecoder(response.Body)
-		if err := decoder.Decode(&apiResponse); err != nil {
-			return out, fmt.Errorf("could not unmarshal response: %w", err)
-		}
+		pages++
 
 		if out == nil {
 			out = make([]T, 0, apiResponse.Count)
@@ -109,3 +258,37 @@ func getMany[T APIResultModel](
 
 	return out, nil
 }
+
+// write sends body with method and returns the object Netbox responds with
+func write[T APIResultModel](
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	method string,
+	url string,
+	body any,
+) (T, error) {
+	var out T
+	response, err := doRequest(ctx, requestClient, method, url, body)
+	if err != nil {
+		return out, err
+	}
+	defer response.Body.Close()
+	if err := responseError(response); err != nil {
+		return out, err
+	}
+	decoder := json.NewDecoder(response.Body)
+	if err := decoder.Decode(&out); err != nil {
+		return out, fmt.Errorf("could not unmarshal response: %w", err)
+	}
+	return out, nil
+}
+
+// remove deletes the object at url
+func remove(ctx context.Context, requestClient *APIRequestClient, url string) error {
+	response, err := doRequest(ctx, requestClient, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return responseError(response)
+}
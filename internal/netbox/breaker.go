@@ -0,0 +1,78 @@
+package netbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests not sent to Netbox because it failed
+// repeatedly
+var ErrCircuitOpen = errors.New("netbox is unavailable; circuit breaker open")
+
+// CircuitBreaker stops requests to Netbox after Threshold consecutive failed
+// requests. After Cooldown, a single request is let through; the breaker
+// closes if it succeeds and opens again otherwise.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is the time the breaker opened, zero while it is closed
+	openedAt time.Time
+	// probing is set while the request after the cooldown is in flight
+	probing bool
+}
+
+// allow returns ErrCircuitOpen if a request must not be sent
+func (breaker *CircuitBreaker) allow() error {
+	if breaker == nil {
+		return nil
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.openedAt.IsZero() {
+		return nil
+	}
+	if breaker.probing || time.Since(breaker.openedAt) < breaker.Cooldown {
+		return ErrCircuitOpen
+	}
+	breaker.probing = true
+	return nil
+}
+
+// done records the outcome of a request allowed by allow. Server errors,
+// rate limiting and failures without a response count as failures; requests
+// cancelled by the caller count as neither.
+func (breaker *CircuitBreaker) done(
+	ctx context.Context,
+	response *http.Response,
+	err error,
+) {
+	if breaker == nil {
+		return
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		breaker.probing = false
+	case err != nil || response.StatusCode >= 500 ||
+		response.StatusCode == http.StatusTooManyRequests:
+		breaker.failures++
+		if breaker.probing || breaker.failures >= breaker.Threshold {
+			if breaker.openedAt.IsZero() {
+				breakerTrips.Inc()
+			}
+			breaker.openedAt = time.Now()
+			breaker.probing = false
+		}
+	default:
+		breaker.failures = 0
+		breaker.openedAt = time.Time{}
+		breaker.probing = false
+	}
+}
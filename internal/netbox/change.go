@@ -0,0 +1,97 @@
+package netbox
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	ObjectTypeRecord string = "netbox_dns.record"
+	ObjectTypeView   string = "netbox_dns.view"
+	ObjectTypeZone   string = "netbox_dns.zone"
+
+	ChangeActionCreate string = "create"
+	ChangeActionUpdate string = "update"
+	ChangeActionDelete string = "delete"
+)
+
+// ObjectChange is an entry in the Netbox changelog
+type ObjectChange struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Action struct {
+		Value string `json:"value"`
+	} `json:"action"`
+	ChangedObjectType string `json:"changed_object_type"`
+	ChangedObjectID   int    `json:"changed_object_id"`
+}
+
+func urlObjectChanges(apiurl *url.URL) *url.URL {
+	return apiurl.JoinPath("core", "object-changes", "/")
+}
+
+// GetLatestObjectChangeID returns the ID of the most recent changelog entry,
+// or 0 if the changelog is empty
+func GetLatestObjectChangeID(ctx context.Context, requestClient *APIRequestClient) (int, error) {
+	requestUrl := urlObjectChanges(requestClient.APIURL)
+	requestUrl.RawQuery = url.Values{
+		"ordering": []string{"-id"},
+		"limit":    []string{"1"},
+	}.Encode()
+	page, err := getPage[ObjectChange](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return 0, err
+	}
+	if len(page.Results) == 0 {
+		return 0, nil
+	}
+	return page.Results[0].ID, nil
+}
+
+// ObjectChangeExists reports whether the changelog entry with the given ID is
+// still retained by Netbox
+func ObjectChangeExists(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	id int,
+) (bool, error) {
+	requestUrl := urlObjectChanges(requestClient.APIURL)
+	requestUrl.RawQuery = url.Values{
+		"id": []string{strconv.Itoa(id)},
+	}.Encode()
+	page, err := getPage[ObjectChange](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return false, err
+	}
+	return page.Count > 0, nil
+}
+
+// GetObjectChangesSince returns the changelog entries for objectTypes with an
+// ID greater than afterID, ordered by ID
+func GetObjectChangesSince(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	objectTypes []string,
+	afterID int,
+) ([]ObjectChange, error) {
+	var out []ObjectChange
+	for _, objectType := range objectTypes {
+		requestUrl := urlObjectChanges(requestClient.APIURL)
+		requestUrl.RawQuery = url.Values{
+			"changed_object_type": []string{objectType},
+			"id__gt":              []string{strconv.Itoa(afterID)},
+			"ordering":            []string{"id"},
+			"limit":               []string{strconv.Itoa(bulkPageLimit)},
+		}.Encode()
+		changes, err := getMany[ObjectChange](ctx, requestClient, requestUrl.String())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, changes...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package netbox
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// NestedObject is a reference to a related object such as a site, role,
+// tenant or tag
+type NestedObject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// NestedIPAddress is a reference to an IPAM IP address
+type NestedIPAddress struct {
+	ID      int    `json:"id"`
+	Address string `json:"address"`
+}
+
+// Host holds the fields devices and virtual machines have in common
+type Host struct {
+	ID         int              `json:"id"`
+	Name       string           `json:"name"`
+	Site       *NestedObject    `json:"site"`
+	Role       *NestedObject    `json:"role"`
+	Tenant     *NestedObject    `json:"tenant"`
+	Tags       []NestedObject   `json:"tags"`
+	PrimaryIP4 *NestedIPAddress `json:"primary_ip4"`
+	PrimaryIP6 *NestedIPAddress `json:"primary_ip6"`
+}
+
+// Device is a DCIM device
+type Device struct {
+	Host
+	DeviceType *NestedObject `json:"device_type"`
+	Rack       *NestedObject `json:"rack"`
+}
+
+// VirtualMachine is a virtualization virtual machine
+type VirtualMachine struct {
+	Host
+	Cluster *NestedObject `json:"cluster"`
+}
+
+// HostQuery filters devices and virtual machines by the slugs of related
+// objects
+type HostQuery struct {
+	Site   []string
+	Role   []string
+	Tenant []string
+	Tag    []string
+}
+
+func (hostQuery *HostQuery) Encode() string {
+	out := url.Values{}
+	for _, site := range hostQuery.Site {
+		out.Add("site", site)
+	}
+	for _, role := range hostQuery.Role {
+		out.Add("role", role)
+	}
+	for _, tenant := range hostQuery.Tenant {
+		out.Add("tenant", tenant)
+	}
+	for _, tag := range hostQuery.Tag {
+		out.Add("tag", tag)
+	}
+	out.Set("has_primary_ip", "true")
+	out.Set("limit", strconv.Itoa(bulkPageLimit))
+	return out.Encode()
+}
+
+func urlDevices(apiurl *url.URL) *url.URL {
+	return apiurl.JoinPath("dcim", "devices", "/")
+}
+
+func urlVirtualMachines(apiurl *url.URL) *url.URL {
+	return apiurl.JoinPath("virtualization", "virtual-machines", "/")
+}
+
+// GetDevices returns the devices with a primary IP address matching query
+func GetDevices(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	query *HostQuery,
+) ([]Device, error) {
+	requestUrl := urlDevices(requestClient.APIURL)
+	requestUrl.RawQuery = query.Encode()
+	devices, err := getMany[Device](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetVirtualMachines returns the virtual machines with a primary IP address
+// matching query
+func GetVirtualMachines(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	query *HostQuery,
+) ([]VirtualMachine, error) {
+	requestUrl := urlVirtualMachines(requestClient.APIURL)
+	requestUrl.RawQuery = query.Encode()
+	virtualMachines, err := getMany[VirtualMachine](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	return virtualMachines, nil
+}
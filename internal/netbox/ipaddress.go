@@ -0,0 +1,42 @@
+package netbox
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+	"strconv"
+)
+
+// IPAddress is an IPAM IP address
+type IPAddress struct {
+	ID      int    `json:"id"`
+	Address string `json:"address"`
+	DNSName string `json:"dns_name"`
+}
+
+// Addr returns the address without its prefix length
+func (ipAddress IPAddress) Addr() (netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(ipAddress.Address)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return prefix.Addr(), nil
+}
+
+func urlIPAddresses(apiurl *url.URL) *url.URL {
+	return apiurl.JoinPath("ipam", "ip-addresses", "/")
+}
+
+// GetIPAddresses returns all IP addresses that have a DNS name set
+func GetIPAddresses(ctx context.Context, requestClient *APIRequestClient) ([]IPAddress, error) {
+	requestUrl := urlIPAddresses(requestClient.APIURL)
+	requestUrl.RawQuery = url.Values{
+		"dns_name__empty": []string{"false"},
+		"limit":           []string{strconv.Itoa(bulkPageLimit)},
+	}.Encode()
+	ipAddresses, err := getMany[IPAddress](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	return ipAddresses, nil
+}
@@ -0,0 +1,71 @@
+package netbox
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// subsystem is the name of the plugin the metrics are exported for
+const subsystem string = "netboxdns"
+
+var (
+	// requestDuration is the duration of Netbox API requests by endpoint and
+	// method
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "api_request_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time (in seconds) each Netbox API request took.",
+	}, []string{"endpoint", "method"})
+	// requestErrors counts failed Netbox API requests by endpoint and status
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "api_errors_total",
+		Help:      "Counter of Netbox API requests failed with an HTTP status or without a response (\"error\").",
+	}, []string{"endpoint", "status"})
+	// requestRetries counts retried Netbox API requests by endpoint
+	requestRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "api_retries_total",
+		Help:      "Counter of Netbox API requests sent again after a transient error.",
+	}, []string{"endpoint"})
+	// breakerTrips counts the times the circuit breaker opened
+	breakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "api_circuit_breaker_trips_total",
+		Help:      "Counter of the times requests to Netbox were stopped after repeated failures.",
+	})
+	// listPages is the number of pages fetched for lists by endpoint
+	listPages = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "api_list_pages",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		Help:      "Histogram of the number of pages fetched for Netbox API lists.",
+	}, []string{"endpoint"})
+)
+
+// endpoint returns the name of the API endpoint of rawURL, the last segment of
+// its path that is not an object ID
+func endpoint(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if _, err := strconv.Atoi(segments[i]); err != nil {
+			return segments[i]
+		}
+	}
+	return ""
+}
@@ -1,23 +1,52 @@
 package netbox
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 	"strconv"
 )
 
 type Record struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
 	Type  string  `json:"type"`
 	Value string  `json:"value"`
 	TTL   *uint32 `json:"ttl"`
 	Zone  Zone    `json:"zone"`
 	FQDN  string  `json:"fqdn"`
+	// Status is active or inactive
+	Status string `json:"status"`
+	// Managed records are maintained by Netbox and cannot be changed
+	Managed bool `json:"managed"`
 }
 
+// RecordWrite is the body of requests creating or changing a record
+type RecordWrite struct {
+	Zone  int     `json:"zone,omitempty"`
+	Name  string  `json:"name,omitempty"`
+	Type  string  `json:"type,omitempty"`
+	Value string  `json:"value,omitempty"`
+	TTL   *uint32 `json:"ttl,omitempty"`
+}
+
+// Statuses of records
+const (
+	RecordStatusActive   string = "active"
+	RecordStatusInactive string = "inactive"
+)
+
 type RecordQuery struct {
-	FQDN string
-	Name string
-	Type []string
-	Zone *Zone
+	FQDN   string
+	Name   string
+	Type   []string
+	Value  string
+	Zone   *Zone
+	Status []string
+	// Zones limits records to the given zones when not nil. It is applied by
+	// GetRecordsQuery, which sets the Zone of the records to the full zone.
+	Zones []Zone
+	Limit int
 }
 
 func (recordQuery *RecordQuery) Encode() string {
@@ -37,10 +66,22 @@ func (recordQuery *RecordQuery) Encode() string {
 		}
 	}
 
+	if recordQuery.Value != "" {
+		out.Set("value", recordQuery.Value)
+	}
+
 	if recordQuery.Zone != nil {
 		out.Set("zone_id", strconv.Itoa(recordQuery.Zone.ID))
 	}
 
+	for _, status := range recordQuery.Status {
+		out.Add("status", status)
+	}
+
+	if recordQuery.Limit > 0 {
+		out.Set("limit", strconv.Itoa(recordQuery.Limit))
+	}
+
 	return out.Encode()
 }
 
@@ -48,16 +89,34 @@ func urlRecords(netboxurl *url.URL) *url.URL {
 	return netboxurl.JoinPath("records", "/")
 }
 
+func urlRecordID(netboxurl *url.URL, id int) *url.URL {
+	return netboxurl.JoinPath("records", "/", strconv.Itoa(id), "/")
+}
+
+// GetRecord returns the record with the given ID. The TTL is left unresolved.
+func GetRecord(ctx context.Context, requestClient *APIRequestClient, id int) (Record, error) {
+	requestUrl := urlRecordID(requestClient.NetboxURL, id)
+	record, err := get[Record](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
 func GetRecordsQuery(
+	ctx context.Context,
 	requestClient *APIRequestClient,
 	query *RecordQuery,
 ) ([]Record, error) {
 	requestUrl := urlRecords(requestClient.NetboxURL)
 	requestUrl.RawQuery = query.Encode()
-	records, err := getMany[Record](requestClient, requestUrl.String())
+	records, err := getMany[Record](ctx, requestClient, requestUrl.String())
 	if err != nil {
 		return nil, err
 	}
+	if query.Zones != nil {
+		return zoneRecords(query, records), nil
+	}
 	if query.Zone != nil {
 		for k, record := range records {
 			if record.TTL == nil {
@@ -65,7 +124,7 @@ func GetRecordsQuery(
 			}
 		}
 	} else {
-		resolvedRecords, err := resolveRecordTTLs(requestClient, records)
+		resolvedRecords, err := resolveRecordTTLs(ctx, requestClient, records)
 		if err != nil {
 			return records, err
 		}
@@ -74,10 +133,50 @@ func GetRecordsQuery(
 	return records, nil
 }
 
+// zoneRecords returns the records in query.Zones with the zone and TTL
+// inherited from it set
+func zoneRecords(query *RecordQuery, records []Record) []Record {
+	zones := make(map[int]Zone, len(query.Zones))
+	for _, zone := range query.Zones {
+		zones[zone.ID] = zone
+	}
+	out := records[:0]
+	for _, record := range records {
+		zone, ok := zones[record.Zone.ID]
+		if !ok {
+			continue
+		}
+		record.Zone = zone
+		if record.TTL == nil {
+			record.TTL = &zone.DefaultTTL
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+// GetRecordsUnresolved returns the records matching query without resolving
+// TTLs that are inherited from the zone. Records are requested in pages of the
+// largest size Netbox allows by default.
+func GetRecordsUnresolved(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	query *RecordQuery,
+) ([]Record, error) {
+	bulkQuery := *query
+	bulkQuery.Limit = bulkPageLimit
+	requestUrl := urlRecords(requestClient.NetboxURL)
+	requestUrl.RawQuery = bulkQuery.Encode()
+	return getMany[Record](ctx, requestClient, requestUrl.String())
+}
+
 func resolveRecordTTLs(
+	ctx context.Context,
 	requestClient *APIRequestClient,
 	records []Record,
 ) ([]Record, error) {
+	span, ctx := StartSpan(ctx, "resolveRecordTTLs")
+	defer span.Finish()
 	zoneTTL := make(map[int]uint32)
 	for k, record := range records {
 		if record.TTL != nil {
@@ -88,7 +187,7 @@ func resolveRecordTTLs(
 			continue
 		}
 		zoneUrl := urlZoneID(requestClient.NetboxURL, record.Zone.ID)
-		zone, err := get[Zone](requestClient, zoneUrl.String())
+		zone, err := get[Zone](ctx, requestClient, zoneUrl.String())
 		if err != nil {
 			return records, err
 		}
@@ -97,3 +196,31 @@ func resolveRecordTTLs(
 	}
 	return records, nil
 }
+
+// CreateRecord creates a record and returns it as stored by Netbox
+func CreateRecord(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	record *RecordWrite,
+) (Record, error) {
+	requestUrl := urlRecords(requestClient.NetboxURL)
+	return write[Record](ctx, requestClient, http.MethodPost, requestUrl.String(), record)
+}
+
+// UpdateRecord changes the fields of the record with the given ID that are set
+// in record and returns it as stored by Netbox
+func UpdateRecord(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	id int,
+	record *RecordWrite,
+) (Record, error) {
+	requestUrl := urlRecordID(requestClient.NetboxURL, id)
+	return write[Record](ctx, requestClient, http.MethodPatch, requestUrl.String(), record)
+}
+
+// DeleteRecord deletes the record with the given ID
+func DeleteRecord(ctx context.Context, requestClient *APIRequestClient, id int) error {
+	requestUrl := urlRecordID(requestClient.NetboxURL, id)
+	return remove(ctx, requestClient, requestUrl.String())
+}
@@ -0,0 +1,110 @@
+package netbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries GET requests that failed with a transient error
+type RetryPolicy struct {
+	// Attempts is the number of times a request is sent at most
+	Attempts int
+	// Backoff is the delay before the first retry. It doubles with every
+	// further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (policy *RetryPolicy) attempts() int {
+	if policy == nil || policy.Attempts < 1 {
+		return 1
+	}
+	return policy.Attempts
+}
+
+// delay returns the time to wait before retrying after attempt failed with
+// response. Netbox asking to wait longer than MaxBackoff with Retry-After
+// reports false.
+func (policy *RetryPolicy) delay(attempt int, response *http.Response) (time.Duration, bool) {
+	if response != nil {
+		if wait, ok := retryAfter(response); ok {
+			return wait, wait <= policy.MaxBackoff
+		}
+	}
+	backoff := policy.Backoff << (attempt - 1)
+	if backoff <= 0 || backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+	// half of the backoff is random so clients failing together spread out
+	half := backoff / 2
+	return half + rand.N(half+1), true
+}
+
+// retryAfter returns the delay requested by the Retry-After header of
+// response, given in seconds or as an HTTP date
+func retryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// retriable reports whether a request answered with response or failed with
+// err is worth sending again
+func retriable(ctx context.Context, response *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode >= 500
+}
+
+// doGet sends a GET request, which is retried according to the retry policy
+// of requestClient
+func doGet(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	url string,
+) (*http.Response, error) {
+	policy := requestClient.Retry
+	for attempt := 1; ; attempt++ {
+		response, err := doRequest(ctx, requestClient, http.MethodGet, url, nil)
+		if attempt >= policy.attempts() || !retriable(ctx, response, err) {
+			return response, err
+		}
+		wait, ok := policy.delay(attempt, response)
+		if !ok {
+			return response, err
+		}
+		if response != nil {
+			io.Copy(io.Discard, io.LimitReader(response.Body, 1024))
+			response.Body.Close()
+		}
+		requestRetries.WithLabelValues(endpoint(url)).Inc()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
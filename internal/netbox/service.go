@@ -0,0 +1,60 @@
+package netbox
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+const (
+	ObjectTypeDevice         string = "dcim.device"
+	ObjectTypeVirtualMachine string = "virtualization.virtualmachine"
+)
+
+// Service is an IPAM service running on a device or virtual machine
+type Service struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Protocol struct {
+		Value string `json:"value"`
+	} `json:"protocol"`
+	Ports []uint16 `json:"ports"`
+	// Device and VirtualMachine are set by Netbox before v4.3
+	Device         *NestedObject `json:"device"`
+	VirtualMachine *NestedObject `json:"virtual_machine"`
+	// ParentObjectType and ParentObjectID are set by Netbox v4.3 and later
+	ParentObjectType string `json:"parent_object_type"`
+	ParentObjectID   int    `json:"parent_object_id"`
+}
+
+// Parent returns the object type and ID of the device or virtual machine the
+// service runs on. The ID is 0 if the service has no such parent.
+func (service Service) Parent() (string, int) {
+	switch {
+	case service.Device != nil:
+		return ObjectTypeDevice, service.Device.ID
+	case service.VirtualMachine != nil:
+		return ObjectTypeVirtualMachine, service.VirtualMachine.ID
+	case service.ParentObjectType == ObjectTypeDevice,
+		service.ParentObjectType == ObjectTypeVirtualMachine:
+		return service.ParentObjectType, service.ParentObjectID
+	}
+	return "", 0
+}
+
+func urlServices(apiurl *url.URL) *url.URL {
+	return apiurl.JoinPath("ipam", "services", "/")
+}
+
+// GetServices returns all services
+func GetServices(ctx context.Context, requestClient *APIRequestClient) ([]Service, error) {
+	requestUrl := urlServices(requestClient.APIURL)
+	requestUrl.RawQuery = url.Values{
+		"limit": []string{strconv.Itoa(bulkPageLimit)},
+	}.Encode()
+	services, err := getMany[Service](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
@@ -0,0 +1,18 @@
+package netbox
+
+import (
+	"context"
+
+	ot "github.com/opentracing/opentracing-go"
+)
+
+// StartSpan starts a span named name as a child of the span in ctx, which is
+// set by the trace plugin. Without one, the span does nothing.
+func StartSpan(ctx context.Context, name string) (ot.Span, context.Context) {
+	parent := ot.SpanFromContext(ctx)
+	if parent == nil {
+		return ot.NoopTracer{}.StartSpan(name), ctx
+	}
+	span := parent.Tracer().StartSpan(name, ot.ChildOf(parent.Context()))
+	return span, ot.ContextWithSpan(ctx, span)
+}
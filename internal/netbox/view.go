@@ -1,6 +1,7 @@
 package netbox
 
 import (
+	"context"
 	"net/netip"
 	"net/url"
 	"strconv"
@@ -15,7 +16,7 @@ type View struct {
 	ID       int      `json:"id"`
 	Name     string   `json:"name"`
 	Prefixes []Prefix `json:"prefixes"`
-	Default  bool     `json:"default_view`
+	Default  bool     `json:"default_view"`
 }
 
 func (v View) ContainsIP(IP netip.Addr) (bool, error) {
@@ -32,15 +33,44 @@ func (v View) ContainsIP(IP netip.Addr) (bool, error) {
 	return false, nil
 }
 
+// MatchPrefix returns the length of the longest prefix of the view that
+// contains IP, or -1 if none does
+func (v View) MatchPrefix(IP netip.Addr) (int, error) {
+	longest := -1
+	for _, prefixObj := range v.Prefixes {
+		prefix, err := netip.ParsePrefix(prefixObj.Prefix)
+		if err != nil {
+			return -1, err
+		}
+		if prefix.Contains(IP) && prefix.Bits() > longest {
+			longest = prefix.Bits()
+		}
+	}
+	return longest, nil
+}
+
+func urlViews(netboxurl *url.URL) *url.URL {
+	return netboxurl.JoinPath("views", "/")
+}
+
 func urlViewID(netboxurl *url.URL, id int) *url.URL {
 	return netboxurl.JoinPath("views", "/", strconv.Itoa(id), "/")
 }
 
-func GetView(requestClient *APIRequestClient, id int) (View, error) {
+func GetView(ctx context.Context, requestClient *APIRequestClient, id int) (View, error) {
 	requestUrl := urlViewID(requestClient.NetboxURL, id)
-	view, err := get[View](requestClient, requestUrl.String())
+	view, err := get[View](ctx, requestClient, requestUrl.String())
 	if err != nil {
 		return View{}, err
 	}
 	return view, nil
 }
+
+func GetViews(ctx context.Context, requestClient *APIRequestClient) ([]View, error) {
+	requestUrl := urlViews(requestClient.NetboxURL)
+	views, err := getMany[View](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	return views, nil
+}
@@ -1,7 +1,9 @@
 package netbox
 
 import (
+	"context"
 	"net/url"
+	"slices"
 	"strconv"
 )
 
@@ -10,10 +12,78 @@ type Zone struct {
 	ID          int        `json:"id"`
 	Name        string     `json:"name"`
 	NameServers []SOAMName `json:"nameservers"`
+	SOAMName    *SOAMName  `json:"soa_mname"`
+	Status      string     `json:"status"`
 	View        struct {
 		ID   int    `json:"id"`
 		Name string `json:"name"`
 	}
+	Tenant       *NestedObject  `json:"tenant"`
+	Tags         []NestedObject `json:"tags"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+// Statuses of zones
+const (
+	ZoneStatusActive     string = "active"
+	ZoneStatusReserved   string = "reserved"
+	ZoneStatusDeprecated string = "deprecated"
+	ZoneStatusParked     string = "parked"
+	ZoneStatusDynamic    string = "dynamic"
+)
+
+// ZoneQuery filters zones by status and the slugs of their tenant and tags.
+// Params are added to the query string as they are.
+type ZoneQuery struct {
+	Status []string
+	Tenant []string
+	Tag    []string
+	Params url.Values
+}
+
+func (zoneQuery *ZoneQuery) Encode() string {
+	out := url.Values{}
+	for key, values := range zoneQuery.Params {
+		for _, value := range values {
+			out.Add(key, value)
+		}
+	}
+	for _, status := range zoneQuery.Status {
+		out.Add("status", status)
+	}
+	for _, tenant := range zoneQuery.Tenant {
+		out.Add("tenant", tenant)
+	}
+	for _, tag := range zoneQuery.Tag {
+		out.Add("tag", tag)
+	}
+	return out.Encode()
+}
+
+// Matches reports whether zone passes the status, tenant and tag filters of
+// the query the way Netbox applies them: the zone has one of the statuses and
+// tenants and all of the tags. Zones without a status are not filtered by it.
+// Params are only applied by Netbox.
+func (zoneQuery *ZoneQuery) Matches(zone Zone) bool {
+	if zoneQuery == nil {
+		return true
+	}
+	if len(zoneQuery.Status) > 0 && zone.Status != "" &&
+		!slices.Contains(zoneQuery.Status, zone.Status) {
+		return false
+	}
+	if len(zoneQuery.Tenant) > 0 &&
+		(zone.Tenant == nil || !slices.Contains(zoneQuery.Tenant, zone.Tenant.Slug)) {
+		return false
+	}
+	for _, slug := range zoneQuery.Tag {
+		if !slices.ContainsFunc(zone.Tags, func(tag NestedObject) bool {
+			return tag.Slug == slug
+		}) {
+			return false
+		}
+	}
+	return true
 }
 
 type SOAMName struct {
@@ -28,11 +98,33 @@ func urlZoneID(netboxurl *url.URL, id int) *url.URL {
 	return netboxurl.JoinPath("zones", "/", strconv.Itoa(id), "/")
 }
 
-func GetZones(requestClient *APIRequestClient) ([]Zone, error) {
+// GetZones returns the zones matching query, which are filtered by Netbox and
+// again by ZoneQuery.Matches
+func GetZones(
+	ctx context.Context,
+	requestClient *APIRequestClient,
+	query *ZoneQuery,
+) ([]Zone, error) {
 	requestUrl := urlZones(requestClient.NetboxURL)
-	zones, err := getMany[Zone](requestClient, requestUrl.String())
+	requestUrl.RawQuery = query.Encode()
+	zones, err := getMany[Zone](ctx, requestClient, requestUrl.String())
 	if err != nil {
 		return nil, err
 	}
-	return zones, nil
+	out := zones[:0]
+	for _, zone := range zones {
+		if query.Matches(zone) {
+			out = append(out, zone)
+		}
+	}
+	return out, nil
+}
+
+func GetZone(ctx context.Context, requestClient *APIRequestClient, id int) (Zone, error) {
+	requestUrl := urlZoneID(requestClient.NetboxURL, id)
+	zone, err := get[Zone](ctx, requestClient, requestUrl.String())
+	if err != nil {
+		return Zone{}, err
+	}
+	return zone, nil
 }
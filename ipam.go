@@ -0,0 +1,146 @@
+package netboxdns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// ipamPrecedence decides which record is served when an IPAM address and a
+// record in Netbox DNS have the same name and type
+type ipamPrecedence int
+
+const (
+	ipamPrecedenceRecords ipamPrecedence = iota
+	ipamPrecedenceIPAM
+)
+
+// ipamSource serves A, AAAA and PTR records for IPAM IP addresses with a DNS
+// name. The records are placed in the most specific Netbox zone of every view
+// that contains their name.
+type ipamSource struct {
+	// zones limits the names records are created for
+	zones      []string
+	precedence ipamPrecedence
+	// records holds the records created from IP addresses
+	records *snapshot
+}
+
+func newIPAMSource() *ipamSource {
+	return &ipamSource{records: newSnapshot()}
+}
+
+// syncIPAM reloads all IP addresses from Netbox and rebuilds their records
+func (netboxdns *NetboxDNS) syncIPAM(ctx context.Context) error {
+	ipAddresses, err := netbox.GetIPAddresses(ctx, netboxdns.requestClient)
+	if err != nil {
+		return err
+	}
+	zones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return err
+	}
+	records := netboxdns.ipam.buildRecords(ipAddresses, zones)
+	setSourceRecords(netboxdns.ipam.records, records)
+	logger.Infof(
+		"loaded %d IPAM addresses as %d records",
+		len(ipAddresses),
+		len(records),
+	)
+	return nil
+}
+
+// buildRecords returns the records for ipAddresses in zones. Records are given
+// negative IDs so they cannot be mistaken for records in Netbox.
+func (source *ipamSource) buildRecords(
+	ipAddresses []netbox.IPAddress,
+	zones []netbox.Zone,
+) []netbox.Record {
+	var out []netbox.Record
+	add := func(name string, rrtype string, value string) {
+		if plugin.Zones(source.zones).Matches(name) == "" {
+			return
+		}
+		for _, zone := range closestZones(name, zones) {
+			out = append(out, netbox.Record{
+				ID:    -len(out) - 1,
+				Name:  relativeName(name, zone.Name),
+				Type:  rrtype,
+				Value: value,
+				Zone:  zone,
+				FQDN:  name,
+			})
+		}
+	}
+	for _, ipAddress := range ipAddresses {
+		if ipAddress.DNSName == "" {
+			continue
+		}
+		addr, err := ipAddress.Addr()
+		if err != nil {
+			logger.Debugf("ignoring IPAM address %d: %v", ipAddress.ID, err)
+			continue
+		}
+		addr = addr.Unmap()
+		name := fqdnKey(ipAddress.DNSName)
+		rrtype := "A"
+		if addr.Is6() {
+			rrtype = "AAAA"
+		}
+		add(name, rrtype, addr.String())
+		reverse, err := dns.ReverseAddr(addr.String())
+		if err != nil {
+			continue
+		}
+		add(reverse, "PTR", name)
+	}
+	return out
+}
+
+// closestZones returns the zones of all views with the longest name that
+// contains name
+func closestZones(name string, zones []netbox.Zone) []netbox.Zone {
+	var out []netbox.Zone
+	longest := 0
+	for _, zone := range zones {
+		zoneName := fqdnKey(zone.Name)
+		if !dns.IsSubDomain(zoneName, name) || len(zoneName) < longest {
+			continue
+		}
+		if len(zoneName) > longest {
+			longest = len(zoneName)
+			out = out[:0]
+		}
+		out = append(out, zone)
+	}
+	return out
+}
+
+// relativeName returns name relative to the zone origin, or "@" for the apex
+func relativeName(name string, zone string) string {
+	if fqdnKey(name) == fqdnKey(zone) {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+fqdnKey(zone))
+}
+
+// mergeIPAM adds the IPAM records matching query to records. Where both have
+// a record with the same name and type in a zone, the configured precedence
+// decides which one is kept.
+func (netboxdns *NetboxDNS) mergeIPAM(
+	query *netbox.RecordQuery,
+	records []netbox.Record,
+) []netbox.Record {
+	source := netboxdns.ipam
+	if source == nil || !source.records.ready() {
+		return records
+	}
+	extra := source.records.getRecords(query)
+	if source.precedence == ipamPrecedenceIPAM {
+		return mergeRecords(extra, records)
+	}
+	return mergeRecords(records, extra)
+}
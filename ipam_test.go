@@ -0,0 +1,66 @@
+package netboxdns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+func TestIPAMBuildRecords(t *testing.T) {
+	netboxdns := newTestPlugin(t, withIPAM(ipamPrecedenceRecords))
+	records := netboxdns.ipam.records.getRecords(&netbox.RecordQuery{})
+	var got []string
+	for _, record := range records {
+		got = append(got, record.Zone.Name+" "+record.Name+" "+record.Type+" "+record.Value)
+	}
+	want := []string{
+		"0.0.10.in-addr.arpa 50 PTR printer.example.com.",
+		"0.0.10.in-addr.arpa 51 PTR web.example.com.",
+		// the reverse zone is configured even though the name is not
+		"0.0.10.in-addr.arpa 53 PTR other.example.net.",
+		"example.com printer A 10.0.0.50",
+		"example.com web A 10.0.0.51",
+		"sub.example.com host AAAA 2001:db8::52",
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got records\n%v\nwant\n%v", got, want)
+	}
+	for _, record := range records {
+		if record.TTL == nil || *record.TTL != record.Zone.DefaultTTL {
+			t.Errorf("record %v does not inherit the zone TTL", record)
+		}
+	}
+}
+
+func TestIPAMPrecedence(t *testing.T) {
+	query := &netbox.RecordQuery{FQDN: "web.example.com", Type: []string{"A"}}
+	tests := []struct {
+		name       string
+		precedence ipamPrecedence
+		want       string
+	}{
+		{"records", ipamPrecedenceRecords, "10.0.0.17"},
+		{"ipam", ipamPrecedenceIPAM, "10.0.0.51"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t, withIPAM(tt.precedence))
+			records, err := netboxdns.getRecords(context.Background(), query)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(records) != 1 || records[0].Value != tt.want {
+				t.Errorf("got %v, want single record with %s", records, tt.want)
+			}
+		})
+	}
+
+	netboxdns := newTestPlugin(t, withIPAM(ipamPrecedenceRecords))
+	records, _ := netboxdns.getRecords(context.Background(), &netbox.RecordQuery{FQDN: "printer.example.com"})
+	if len(records) != 1 {
+		t.Errorf("IPAM record without conflict not served: %v", records)
+	}
+}
@@ -0,0 +1,138 @@
+package netboxdns
+
+import (
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+const defaultJournalSize int = 10
+
+// journalEntry holds the records deleted and added between two serials
+type journalEntry struct {
+	fromSOA *dns.SOA
+	toSOA   *dns.SOA
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+// journal keeps a bounded history of changes per zone to answer IXFR
+type journal struct {
+	mu      sync.Mutex
+	size    int
+	entries map[int][]journalEntry
+}
+
+func newJournal(size int) *journal {
+	return &journal{
+		size:    size,
+		entries: make(map[int][]journalEntry),
+	}
+}
+
+// record adds change to the journal of its zone. A change that does not bump
+// the serial cannot be expressed as an IXFR difference, so the history of the
+// zone is discarded and secondaries fall back to AXFR.
+func (j *journal) record(change zoneChange) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !change.serialChanged() || !serialNewer(change.newSOA.Serial, change.oldSOA.Serial) {
+		delete(j.entries, change.zone.ID)
+		return
+	}
+	entries := append(j.entries[change.zone.ID], journalEntry{
+		fromSOA: change.oldSOA,
+		toSOA:   change.newSOA,
+		deleted: change.deleted,
+		added:   change.added,
+	})
+	if len(entries) > j.size {
+		entries = entries[len(entries)-j.size:]
+	}
+	j.entries[change.zone.ID] = entries
+}
+
+func (j *journal) drop(zoneID int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.entries, zoneID)
+}
+
+// diff returns the condensed difference of the zone from serial to current,
+// or nil if the journal does not reach back to serial or does not end at
+// current.
+func (j *journal) diff(zoneID int, serial uint32, current uint32) *journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := j.entries[zoneID]
+	start := -1
+	for i, entry := range entries {
+		if entry.fromSOA.Serial == serial {
+			start = i
+			break
+		}
+	}
+	if start == -1 || entries[len(entries)-1].toSOA.Serial != current {
+		return nil
+	}
+
+	deleted := make(map[string]dns.RR)
+	added := make(map[string]dns.RR)
+	for _, entry := range entries[start:] {
+		for _, rr := range entry.deleted {
+			key := rr.String()
+			if _, ok := added[key]; ok {
+				delete(added, key)
+			} else {
+				deleted[key] = rr
+			}
+		}
+		for _, rr := range entry.added {
+			key := rr.String()
+			if _, ok := deleted[key]; ok {
+				delete(deleted, key)
+			} else {
+				added[key] = rr
+			}
+		}
+	}
+	out := &journalEntry{
+		fromSOA: entries[start].fromSOA,
+		toSOA:   entries[len(entries)-1].toSOA,
+	}
+	for _, rr := range deleted {
+		out.deleted = append(out.deleted, rr)
+	}
+	for _, rr := range added {
+		out.added = append(out.added, rr)
+	}
+	return out
+}
+
+// journalDiff returns the difference of the zone from serial to current if
+// the journal is enabled and covers it
+func (netboxdns *NetboxDNS) journalDiff(
+	zoneID int,
+	serial uint32,
+	current uint32,
+) *journalEntry {
+	if netboxdns.journal == nil {
+		return nil
+	}
+	return netboxdns.journal.diff(zoneID, serial, current)
+}
+
+// sendIXFR writes a condensed IXFR response to ch as described in RFC 1995
+func sendIXFR(ch chan<- []dns.RR, diff *journalEntry) {
+	ch <- []dns.RR{diff.toSOA, diff.fromSOA}
+	for start := 0; start < len(diff.deleted); start += transferBatchSize {
+		end := min(start+transferBatchSize, len(diff.deleted))
+		ch <- diff.deleted[start:end]
+	}
+	ch <- []dns.RR{diff.toSOA}
+	for start := 0; start < len(diff.added); start += transferBatchSize {
+		end := min(start+transferBatchSize, len(diff.added))
+		ch <- diff.added[start:end]
+	}
+	ch <- []dns.RR{diff.toSOA}
+}
@@ -0,0 +1,85 @@
+package netboxdns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestJournalIXFR(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	netboxdns.journal = newJournal(defaultJournalSize)
+	tracker := netboxdns.zoneChanges()
+	tracker.onChange(netboxdns.journal.record)
+	tracker.onRemove(netboxdns.journal.drop)
+	netboxdns.trackChanges(context.Background())
+
+	zone, _ := netboxdns.snapshot.getZone(1)
+	soa := func(serial string) netbox.Record {
+		return netbox.Record{ID: 1, Name: "@", Type: "SOA", Value: "dns01.example.com. admin.example.com. " + serial + " 43200 7200 2419200 3600", FQDN: "example.com.", Zone: zone}
+	}
+
+	// serial 2: add new, serial 3: delete new again and delete web A
+	netboxdns.snapshot.putRecord(soa("2"))
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 20, Name: "new", Type: "A", Value: "10.0.0.20", FQDN: "new.example.com.", Zone: zone})
+	netboxdns.trackChanges(context.Background())
+	netboxdns.snapshot.putRecord(soa("3"))
+	netboxdns.snapshot.deleteRecord(20)
+	netboxdns.snapshot.deleteRecord(2)
+	netboxdns.trackChanges(context.Background())
+
+	ch, err := netboxdns.Transfer("example.com.", 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	rrs := collectTransfer(t, ch)
+	// SOA 3, SOA 1, web A, SOA 3, SOA 3
+	if len(rrs) != 5 {
+		t.Fatalf("got %d records, want 5: %v", len(rrs), rrs)
+	}
+	serials := []uint32{3, 1, 0, 3, 3}
+	for i, serial := range serials {
+		if serial == 0 {
+			if a, ok := rrs[i].(*dns.A); !ok || a.A.String() != "10.0.0.17" {
+				t.Errorf("record %d: expected deleted web A record, got %v", i, rrs[i])
+			}
+			continue
+		}
+		if s, ok := rrs[i].(*dns.SOA); !ok || s.Serial != serial {
+			t.Errorf("record %d: expected SOA with serial %d, got %v", i, serial, rrs[i])
+		}
+	}
+
+	// serial older than the journal falls back to AXFR
+	ch, err = netboxdns.Transfer("example.com.", 4294967295)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	rrs = collectTransfer(t, ch)
+	if len(rrs) != 5 {
+		t.Errorf("expected AXFR fallback with 5 records, got %v", rrs)
+	}
+}
+
+func TestJournalUnserialledChange(t *testing.T) {
+	j := newJournal(2)
+	soa := func(serial uint32) *dns.SOA {
+		return &dns.SOA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA}, Serial: serial}
+	}
+	zone := netbox.Zone{ID: 1}
+	j.record(zoneChange{zone: zone, oldSOA: soa(1), newSOA: soa(2)})
+	j.record(zoneChange{zone: zone, oldSOA: soa(2), newSOA: soa(3)})
+	j.record(zoneChange{zone: zone, oldSOA: soa(3), newSOA: soa(4)})
+	if diff := j.diff(1, 1, 4); diff != nil {
+		t.Errorf("expected serial 1 to be evicted from journal of size 2")
+	}
+	if diff := j.diff(1, 2, 4); diff == nil {
+		t.Errorf("expected journal to cover serial 2")
+	}
+	j.record(zoneChange{zone: zone, oldSOA: soa(4), newSOA: soa(4)})
+	if diff := j.diff(1, 3, 4); diff != nil {
+		t.Errorf("expected journal to be cleared by change without serial bump")
+	}
+}
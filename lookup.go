@@ -1,8 +1,10 @@
 package netboxdns
 
 import (
+	"context"
 	"fmt"
 	"net/netip"
+	"sort"
 	"strings"
 
 	"github.com/coredns/coredns/plugin/pkg/log"
@@ -16,6 +18,7 @@ const (
 	lookupSuccess    lookupResult = iota
 	lookupNameError               // NXDomain
 	lookupDelegation              // Delegate, non-authoritative
+	lookupNoData                  // NoData, name exists without the type
 )
 
 type lookupResponse struct {
@@ -23,143 +26,294 @@ type lookupResponse struct {
 	Ns           []dns.RR
 	Extra        []dns.RR
 	LookupResult lookupResult
+	// Zone is the Netbox zone the response was built from
+	Zone *netbox.Zone
+	// Wildcard is the owner of the wildcard the answer was synthesized from
+	Wildcard string
 }
 
 func (netboxdns *NetboxDNS) lookup(
+	ctx context.Context,
 	name string,
 	reqIP netip.Addr,
+	viewName string,
 	qtype uint16,
 	family int,
 ) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "lookup")
+	defer span.Finish()
 	logger.Debugf("request for [%v] %v from %v\n", dns.TypeToString[qtype], name, reqIP)
 
 	nameTrimmed := strings.TrimSuffix(name, ".")
 	// check if zone exists on Netbox
-	zones, default_zone_index, err := netboxdns.matchZone(nameTrimmed, reqIP)
+	zones, err := netboxdns.matchZone(ctx, nameTrimmed, reqIP, viewName)
 	if err != nil {
 		return nil, err
 	}
 	if zones == nil {
 		logger.Debugf("no zone matching %q", name)
+		if netboxdns.synthesizePTR && qtype == dns.TypePTR {
+			synthesized, err := netboxdns.lookupSynthesizedPTR(ctx, name, reqIP, viewName)
+			if err != nil || synthesized != nil {
+				return synthesized, err
+			}
+		}
 		return &lookupResponse{LookupResult: lookupNameError}, nil
 	}
 
-	// var responses []*lookupResponse
-	var defaultResponse *lookupResponse
+	// the view taking precedence that has a zone containing qname answers
+	// alone; the records it omits must not be served from other views
+	for i, zone := range zones {
+		if zone.View.ID != zones[0].View.ID {
+			zones = zones[:i]
+			break
+		}
+	}
+
+	// zones are ordered from most to least specific, so the first answer
+	// found wins
 	for i, zone := range zones {
-		is_zone_default := i == default_zone_index
+		if zone.Status == netbox.ZoneStatusParked {
+			logger.Debugf("answering %q from parked zone %v", name, zone.Name)
+			parked, err := netboxdns.parkedResponse(ctx, nameTrimmed, qtype, zone)
+			if err != nil {
+				return nil, err
+			}
+			parked.Zone = zone
+			return parked, nil
+		}
+
 		// check if qname is for zone origin
 		if nameTrimmed == zone.Name {
-			originResponse, err := netboxdns.processOrigin(qtype, zone)
+			originResponse, err := netboxdns.processOrigin(ctx, qtype, zone)
 			if err != nil {
-				log.Debugf("Could not process origin for zone %v: %w", zone, err)
+				log.Debugf("Could not process origin for zone %v: %v", zone, err)
 				continue
 			}
 			if originResponse != nil {
+				originResponse.Zone = zone
 				logger.Debugf(
 					"found origin records for [%s] %q in zone %v",
 					dns.TypeToString[qtype],
 					name,
 					zone.Name,
 				)
-				if is_zone_default {
-					return originResponse, nil
-				} else {
-					defaultResponse = originResponse
-				}
-				continue
+				return originResponse, nil
 			}
 		}
 
 		// lookup exact request
-		direct, err := netboxdns.lookupDirect(nameTrimmed, qtype, zone)
+		direct, err := netboxdns.lookupDirect(ctx, nameTrimmed, qtype, zone)
 		if err != nil {
-			log.Debugf("could not lookup exact request for %v in zone %v: %w", nameTrimmed, zone.Name, err)
+			log.Debugf("could not lookup exact request for %v in zone %v: %v", nameTrimmed, zone.Name, err)
 			continue
 		}
 		if direct != nil {
+			direct.Zone = zone
 			logger.Debugf(
 				"found records for [%s] %q in zone %v",
 				dns.TypeToString[qtype],
 				name,
 				zone.View.Name,
 			)
-			if is_zone_default {
-				return direct, nil
-			} else {
-				defaultResponse = direct
-			}
-			continue
+			return direct, nil
 		}
 
 		// if no exact records exist for the request, check if the qname is a
 		// delegate zone
-		delegate, err := netboxdns.lookupDelegate(nameTrimmed, zone, qtype)
+		delegate, err := netboxdns.lookupDelegate(ctx, nameTrimmed, zone, qtype)
 		if err != nil {
-			log.Debugf("could not lookup delegate for %v in zone %v: %w", nameTrimmed, zone.Name, err)
+			log.Debugf("could not lookup delegate for %v in zone %v: %v", nameTrimmed, zone.Name, err)
 			continue
 		}
 		if delegate != nil {
+			delegate.Zone = zone
 			logger.Debugf("found delegate zone records for %q in zone %v", name, zone.Name)
-			// return delegate, nil
-			if is_zone_default {
-				return delegate, nil
-			} else {
-				defaultResponse = delegate
-			}
+			return delegate, nil
+		}
 
+		// if the qname does not exist, synthesize it from a wildcard. Only the
+		// most specific zone is authoritative for qname, so the wildcards of
+		// its parent zones do not apply (RFC 4592).
+		if i > 0 {
+			continue
+		}
+		wildcard, err := netboxdns.lookupWildcard(ctx, nameTrimmed, qtype, zone)
+		if err != nil {
+			log.Debugf("could not lookup wildcard for %v in zone %v: %v", nameTrimmed, zone.Name, err)
 			continue
 		}
+		if wildcard != nil {
+			wildcard.Zone = zone
+			logger.Debugf(
+				"synthesized [%s] %q from %q in zone %v",
+				dns.TypeToString[qtype],
+				name,
+				wildcard.Wildcard,
+				zone.Name,
+			)
+			return wildcard, nil
+		}
 	}
-	if defaultResponse != nil {
-		return defaultResponse, nil
-	} else {
-		log.Errorf("could not resolve any records for request %v", nameTrimmed)
-		return nil, fmt.Errorf("could not resolve any records for request %v ", nameTrimmed)
+	// the most specific zone of the view taking precedence is authoritative
+	zone := zones[0]
+	// a PTR record in Netbox always wins over a synthesized one
+	if netboxdns.synthesizePTR && qtype == dns.TypePTR {
+		synthesized, err := netboxdns.lookupSynthesizedPTR(ctx, name, reqIP, viewName)
+		if err != nil {
+			return nil, err
+		}
+		if synthesized != nil {
+			synthesized.Zone = zone
+			logger.Debugf("synthesized PTR for %q from forward records", name)
+			return synthesized, nil
+		}
 	}
+	negative, err := netboxdns.negativeResponse(ctx, nameTrimmed, zone)
+	if err != nil {
+		return nil, err
+	}
+	negative.Zone = zone
+	logger.Debugf(
+		"no records for [%s] %q in zone %v; name exists: %t",
+		dns.TypeToString[qtype],
+		name,
+		zone.Name,
+		negative.LookupResult == lookupNoData,
+	)
+	return negative, nil
 }
 
-func (netboxdns *NetboxDNS) matchZone(qname string, reqIP netip.Addr) ([]*netbox.Zone, int, error) {
-	managedZones, err := netbox.GetZones(netboxdns.requestClient)
+// negativeResponse returns an NXDOMAIN or NODATA response for qname in zone
+// with the SOA of the zone in the authority section as described in RFC 2308
+func (netboxdns *NetboxDNS) negativeResponse(
+	ctx context.Context,
+	qname string,
+	zone *netbox.Zone,
+) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "negativeResponse")
+	defer span.Finish()
+	exists, err := netboxdns.nameExists(ctx, qname, zone)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	var out []*netbox.Zone
-	index_of_default := -1
-	for _, managedZone := range managedZones {
-		view, err := netbox.GetView(netboxdns.requestClient, managedZone.View.ID)
-		if err != nil {
-			return nil, 0, err
-		}
+	response := &lookupResponse{LookupResult: lookupNameError}
+	if exists {
+		response.LookupResult = lookupNoData
+	}
+	records, err := netboxdns.getRecords(
+		ctx,
+		&netbox.RecordQuery{
+			Name: "@",
+			Type: []string{"SOA"},
+			Zone: zone,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	rrs, err := recordsToRR(records)
+	if err != nil {
+		return nil, err
+	}
+	// the SOA keeps the TTL it has in the zone until the response is complete,
+	// so that its signature covers it (see negativeTTL)
+	response.Ns = append(response.Ns, rrs...)
+	return response, nil
+}
 
-		viewContainsIP, err := view.ContainsIP(reqIP)
-		if err != nil {
-			return nil, 0, err
+// negativeTTL lowers the TTL of the SOA in the authority section of a
+// negative answer, and of its signatures, to the lower of the SOA TTL and
+// minimum as described in RFC 2308 section 3. The signatures keep the TTL of
+// the SOA in the zone as their original TTL.
+func negativeTTL(rrs []dns.RR) {
+	var soa *dns.SOA
+	for _, rr := range rrs {
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+			break
 		}
-		if !viewContainsIP {
-			log.Debugf("view %v's configured prefixes don't match request IP %v", view.Name, reqIP.String())
-			continue
+	}
+	if soa == nil {
+		return
+	}
+	ttl := min(soa.Hdr.Ttl, soa.Minttl)
+	for _, rr := range rrs {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			rr.Hdr.Ttl = ttl
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeSOA {
+				rr.Hdr.Ttl = ttl
+			}
 		}
-		log.Debugf("view %v's configured prefixes match request IP %v", view.Name, reqIP.String())
+	}
+}
 
-		if dns.IsSubDomain(managedZone.Name, qname) {
-			out = append(out, &managedZone)
-			if view.Default {
-				if index_of_default != -1 {
-					log.Errorf("more than one default view configured for IP %v", reqIP.String())
-					return nil, 0, fmt.Errorf("more than one default view configured for IP %v", reqIP.String())
-				}
-				index_of_default = len(out)
-			}
+// nameExists reports whether qname owns records in zone, is an empty
+// non-terminal, i.e. only names below it own records, or matches a wildcard
+func (netboxdns *NetboxDNS) nameExists(
+	ctx context.Context,
+	qname string,
+	zone *netbox.Zone,
+) (bool, error) {
+	// the names were usually looked up for the wildcard already
+	names, err := netboxdns.zoneNames(ctx, zone)
+	if err != nil {
+		return false, err
+	}
+	if names[fqdnKey(qname)] {
+		return true, nil
+	}
+	// a wildcard without records of the queried type matches qname as well
+	return names["*."+closestEncloser(qname, names)], nil
+}
+
+// matchZone returns the zones containing qname in the views of the client at
+// reqIP, or in the view named viewName if set. Zones are ordered by the
+// precedence of their view and then from most to least specific.
+func (netboxdns *NetboxDNS) matchZone(
+	ctx context.Context,
+	qname string,
+	reqIP netip.Addr,
+	viewName string,
+) ([]*netbox.Zone, error) {
+	span, ctx := netbox.StartSpan(ctx, "matchZone")
+	defer span.Finish()
+	viewIDs, err := netboxdns.clientViews(ctx, reqIP, viewName)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("views of %v in order of precedence: %v", reqIP, viewIDs)
+	ranks := viewRanks(viewIDs)
+	managedZones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []*netbox.Zone
+	for i := range managedZones {
+		zone := &managedZones[i]
+		if _, ok := ranks[zone.View.ID]; !ok || !dns.IsSubDomain(zone.Name, qname) {
+			continue
 		}
+		out = append(out, zone)
 	}
-	return out, index_of_default, nil
+	sort.SliceStable(out, func(i, j int) bool {
+		if ranks[out[i].View.ID] != ranks[out[j].View.ID] {
+			return ranks[out[i].View.ID] < ranks[out[j].View.ID]
+		}
+		return len(out[i].Name) > len(out[j].Name)
+	})
+	return out, nil
 }
 
 func (netboxdns *NetboxDNS) processOrigin(
+	ctx context.Context,
 	qtype uint16,
 	zone *netbox.Zone,
 ) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "processOrigin")
+	defer span.Finish()
 	var queryType []string
 	switch qtype {
 	case dns.TypeSOA:
@@ -169,8 +323,8 @@ func (netboxdns *NetboxDNS) processOrigin(
 	default:
 		return nil, nil
 	}
-	records, err := netbox.GetRecordsQuery(
-		netboxdns.requestClient,
+	records, err := netboxdns.getRecords(
+		ctx,
 		&netbox.RecordQuery{
 			Name: "@",
 			Type: queryType,
@@ -186,14 +340,14 @@ func (netboxdns *NetboxDNS) processOrigin(
 	}
 	answer := filterRRByType(rrs, dns.TypeSOA)
 	ns := filterRRByType(rrs, dns.TypeNS)
-	extraRecords, err := netboxdns.processExtra(ns, zone, qtype)
+	extraRecords, err := netboxdns.processExtra(ctx, ns, zone, qtype)
 	if err != nil {
 		return nil, err
 	}
 	if len(extraRecords) == 0 {
 		// if no A/AAAA records exist for the NS in the specified zone, check if
 		// the server has records anywhere
-		extraRecords, err = netboxdns.processExtra(ns, nil, qtype)
+		extraRecords, err = netboxdns.processExtra(ctx, ns, nil, qtype)
 		if err != nil {
 			return nil, err
 		}
@@ -214,6 +368,7 @@ func (netboxdns *NetboxDNS) processOrigin(
 }
 
 func (netboxdns *NetboxDNS) processExtra(
+	ctx context.Context,
 	answer []dns.RR,
 	zone *netbox.Zone,
 	qtype uint16,
@@ -241,8 +396,8 @@ func (netboxdns *NetboxDNS) processExtra(
 		//case 2:
 		//	reqType = []string{"AAAA"}
 		//}
-		records, err := netbox.GetRecordsQuery(
-			netboxdns.requestClient,
+		records, err := netboxdns.getRecords(
+			ctx,
 			&netbox.RecordQuery{
 				FQDN: strings.TrimSuffix(name, "."),
 				Type: []string{dns.TypeToString[qtype]},
@@ -258,17 +413,20 @@ func (netboxdns *NetboxDNS) processExtra(
 }
 
 func (netboxdns *NetboxDNS) lookupDirect(
+	ctx context.Context,
 	qname string,
 	qtype uint16,
 	zone *netbox.Zone,
 ) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "lookupDirect")
+	defer span.Finish()
 	queryTypes := []string{dns.TypeToString[qtype]}
 	if qtype == dns.TypeA || qtype == dns.TypeAAAA {
 		queryTypes = append(queryTypes, "CNAME")
 	}
 
-	records, err := netbox.GetRecordsQuery(
-		netboxdns.requestClient,
+	records, err := netboxdns.getRecords(
+		ctx,
 		&netbox.RecordQuery{
 			FQDN: qname,
 			Type: queryTypes,
@@ -296,8 +454,8 @@ func (netboxdns *NetboxDNS) lookupDirect(
 					records[i].Value = strings.Join([]string{record.Value, ".", zone.Name, "."}, "")
 				}
 				// log.Debugf("%v", records[i].Value)
-				newRecordsForCNAME, err := netbox.GetRecordsQuery(
-					netboxdns.requestClient,
+				newRecordsForCNAME, err := netboxdns.getRecords(
+					ctx,
 					&netbox.RecordQuery{
 						FQDN: records[i].Value,
 						Type: queryTypes,
@@ -338,9 +496,25 @@ func (netboxdns *NetboxDNS) lookupDirect(
 
 	log.Debug(answer)
 	if len(answer) > 0 {
+		extra := []dns.RR{}
+		if qtype == dns.TypeSRV {
+			// SRV targets are usually served by the plugin as well, so their
+			// addresses save the resolver another query
+			for _, addressType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				extraRecords, err := netboxdns.processExtra(ctx, answer, nil, addressType)
+				if err != nil {
+					return nil, err
+				}
+				extraRRs, err := recordsToRR(extraRecords)
+				if err != nil {
+					return nil, err
+				}
+				extra = append(extra, extraRRs...)
+			}
+		}
 		return &lookupResponse{
 			Answer: answer,
-			Extra:  []dns.RR{},
+			Extra:  extra,
 		}, nil
 	} else {
 		return nil, nil
@@ -348,12 +522,19 @@ func (netboxdns *NetboxDNS) lookupDirect(
 }
 
 func (netboxdns *NetboxDNS) lookupDelegate(
+	ctx context.Context,
 	qname string,
 	zone *netbox.Zone,
 	qtype uint16,
 ) (*lookupResponse, error) {
-	records, err := netbox.GetRecordsQuery(
-		netboxdns.requestClient,
+	span, ctx := netbox.StartSpan(ctx, "lookupDelegate")
+	defer span.Finish()
+	if qname == zone.Name {
+		// NS records at the apex are the zone's own, not a delegation
+		return nil, nil
+	}
+	records, err := netboxdns.getRecords(
+		ctx,
 		&netbox.RecordQuery{
 			FQDN: qname,
 			Type: []string{"NS"},
@@ -368,7 +549,7 @@ func (netboxdns *NetboxDNS) lookupDelegate(
 		if err != nil {
 			return nil, err
 		}
-		extraRecords, err := netboxdns.processExtra(ns, nil, qtype)
+		extraRecords, err := netboxdns.processExtra(ctx, ns, nil, qtype)
 		if err != nil {
 			return nil, err
 		}
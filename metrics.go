@@ -0,0 +1,131 @@
+package netboxdns
+
+import (
+	"net"
+	"sync"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of answered requests
+const (
+	resultSuccess    string = "success"
+	resultNameError  string = "nxdomain"
+	resultDelegation string = "delegation"
+	resultNoData     string = "nodata"
+	resultServFail   string = "servfail"
+	// resultFallthrough counts NXDOMAIN answers passed to the next plugin
+	resultFallthrough string = "fallthrough"
+)
+
+var (
+	// requestCount counts the requests answered from Netbox by the zone and
+	// view they were answered from
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "requests_total",
+		Help:      "Counter of requests answered by zone, view, type and result.",
+	}, []string{"server", "zone", "view", "qtype", "result"})
+	// snapshotAge is the time since the snapshot was last fully loaded
+	snapshotAge = newSnapshotAgeCollector()
+	// snapshotLookups counts the lookups of zones and records answered from
+	// the snapshot (hit) or sent to Netbox (miss)
+	snapshotLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "snapshot_lookups_total",
+		Help:      "Counter of lookups answered from the snapshot (hit) or Netbox (miss).",
+	}, []string{"result"})
+)
+
+// lookupResultLabel returns the result label of requestCount for result
+func lookupResultLabel(result lookupResult) string {
+	switch result {
+	case lookupNameError:
+		return resultNameError
+	case lookupDelegation:
+		return resultDelegation
+	case lookupNoData:
+		return resultNoData
+	}
+	return resultSuccess
+}
+
+// snapshotAgeCollector exports the age of the snapshot of every plugin
+// instance at the time it is collected
+type snapshotAgeCollector struct {
+	desc *prometheus.Desc
+
+	mu sync.Mutex
+	// instances maps plugin instances to the servers they are part of
+	instances map[*NetboxDNS][]string
+}
+
+func newSnapshotAgeCollector() *snapshotAgeCollector {
+	collector := &snapshotAgeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(plugin.Namespace, pluginName, "snapshot_age_seconds"),
+			"The time (in seconds) since the snapshot was last loaded from Netbox.",
+			[]string{"server"},
+			nil,
+		),
+		instances: make(map[*NetboxDNS][]string),
+	}
+	prometheus.MustRegister(collector)
+	return collector
+}
+
+// Describe implements the prometheus.Collector interface
+func (collector *snapshotAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.desc
+}
+
+// Collect implements the prometheus.Collector interface
+func (collector *snapshotAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for netboxdns, servers := range collector.instances {
+		if !netboxdns.snapshot.ready() {
+			continue
+		}
+		age := netboxdns.snapshot.age().Seconds()
+		for _, server := range servers {
+			ch <- prometheus.MustNewConstMetric(
+				collector.desc,
+				prometheus.GaugeValue,
+				age,
+				server,
+			)
+		}
+	}
+}
+
+func (collector *snapshotAgeCollector) add(netboxdns *NetboxDNS, servers []string) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.instances[netboxdns] = servers
+}
+
+func (collector *snapshotAgeCollector) remove(netboxdns *NetboxDNS) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	delete(collector.instances, netboxdns)
+}
+
+// serverLabels returns the server labels of the requests to the server block
+// of config, which are built like the addresses of its servers
+func serverLabels(config *dnsserver.Config) []string {
+	out := make([]string, 0, len(config.ListenHosts))
+	for _, host := range config.ListenHosts {
+		hostPort := net.JoinHostPort(host, config.Port)
+		if addr, err := net.ResolveTCPAddr("tcp", hostPort); err == nil {
+			hostPort = addr.String()
+		}
+		out = append(out, config.Transport+"://"+hostPort)
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package netboxdns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// gatheredValue returns the value of the counter or gauge or the sample count
+// of the histogram named name with the given labels from the default registry
+func gatheredValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matches := true
+			for _, pair := range metric.GetLabel() {
+				if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+					matches = false
+				}
+			}
+			if !matches {
+				continue
+			}
+			if metric.GetHistogram() != nil {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			if metric.GetGauge() != nil {
+				return metric.GetGauge().GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestMetricsRequestCount(t *testing.T) {
+	tests := []struct {
+		qname  string
+		zone   string
+		result string
+	}{
+		{"web.example.com.", "example.com", resultSuccess},
+		{"missing.example.com.", "example.com", resultNameError},
+		{"web.example.com.", "example.com", resultSuccess},
+	}
+	netboxdns := newTestPlugin(t)
+	zone, _ := netboxdns.snapshot.getZone(1)
+	zone.View.Name = "default"
+	netboxdns.snapshot.putZone(zone)
+	for _, tt := range tests {
+		counter := requestCount.WithLabelValues("", tt.zone, "default", "A", tt.result)
+		before := testutil.ToFloat64(counter)
+		req := new(dns.Msg)
+		req.SetQuestion(tt.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("%s: counted %v %s requests, want 1", tt.qname, got, tt.result)
+		}
+	}
+}
+
+func TestMetricsRequestCountFallthrough(t *testing.T) {
+	netboxdns := newTestPlugin(t)
+	netboxdns.Next = test.NextHandler(dns.RcodeNameError, nil)
+	netboxdns.fall.SetZonesFromArgs(nil)
+	zone, _ := netboxdns.snapshot.getZone(1)
+	zone.View.Name = "default"
+	netboxdns.snapshot.putZone(zone)
+	counter := requestCount.WithLabelValues("", "example.com", "default", "A", resultFallthrough)
+	before := testutil.ToFloat64(counter)
+	req := new(dns.Msg)
+	req.SetQuestion("missing.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("counted %v fallthrough requests, want 1", got)
+	}
+}
+
+func TestMetricsSnapshotAge(t *testing.T) {
+	netboxdns := newTestPlugin(t)
+	netboxdns.snapshot.mu.Lock()
+	netboxdns.snapshot.loaded = time.Now().Add(-time.Minute)
+	netboxdns.snapshot.mu.Unlock()
+	snapshotAge.add(netboxdns, []string{"dns://:1053"})
+	defer snapshotAge.remove(netboxdns)
+
+	// the age is reported without any request being served
+	name := "coredns_netboxdns_snapshot_age_seconds"
+	labels := map[string]string{"server": "dns://:1053"}
+	first := gatheredValue(t, name, labels)
+	if first < 60 {
+		t.Errorf("got snapshot age %v, want at least 60", first)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if second := gatheredValue(t, name, labels); second <= first {
+		t.Errorf("snapshot age did not grow between scrapes: %v, %v", first, second)
+	}
+}
+
+func TestMetricsAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// the served zones are requested before the records
+		if path.Base(request.URL.Path) == "zones" {
+			writer.Write([]byte(`{"count":0,"next":null,"results":[]}`))
+			return
+		}
+		http.Error(writer, "unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+	netboxdns := newTestPlugin(t)
+	netboxdns.snapshot = newSnapshot()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+
+	errorLabels := map[string]string{"endpoint": "records", "status": "502"}
+	durationLabels := map[string]string{"endpoint": "records", "method": http.MethodGet}
+	errorsBefore := gatheredValue(t, "coredns_netboxdns_api_errors_total", errorLabels)
+	durationBefore := gatheredValue(t, "coredns_netboxdns_api_request_duration_seconds", durationLabels)
+	missesBefore := testutil.ToFloat64(snapshotLookups.WithLabelValues("miss"))
+
+	if _, err := netboxdns.getRecords(context.Background(), &netbox.RecordQuery{FQDN: "web.example.com"}); err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if got := gatheredValue(t, "coredns_netboxdns_api_errors_total", errorLabels) - errorsBefore; got != 1 {
+		t.Errorf("counted %v API errors, want 1", got)
+	}
+	if got := gatheredValue(t, "coredns_netboxdns_api_request_duration_seconds", durationLabels) - durationBefore; got != 1 {
+		t.Errorf("observed %v API request durations, want 1", got)
+	}
+	if got := testutil.ToFloat64(snapshotLookups.WithLabelValues("miss")) - missesBefore; got != 1 {
+		t.Errorf("counted %v snapshot misses, want 1", got)
+	}
+}
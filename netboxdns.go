@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
@@ -16,6 +17,11 @@ import (
 
 const (
 	defaultHTTPClientTimeout time.Duration = time.Second * 5
+	defaultRetryAttempts     int           = 3
+	defaultRetryBackoff      time.Duration = time.Millisecond * 100
+	defaultRetryMaxBackoff   time.Duration = time.Second * 2
+	defaultBreakerThreshold  int           = 5
+	defaultBreakerCooldown   time.Duration = time.Second * 30
 	pluginName               string        = "netboxdns"
 )
 
@@ -32,17 +38,126 @@ type NetboxDNS struct {
 
 	zones []string
 	fall  fall.F
+
+	// refresh is the interval the in-memory snapshot is reloaded at. A zero
+	// value disables the snapshot and every query is sent to Netbox.
+	refresh       time.Duration
+	snapshot      *snapshot
+	stopRefreshCh chan struct{}
+	// changelog enables incremental snapshot updates from the Netbox
+	// changelog when not nil
+	changelog *changelogSync
+	// webhook receives Netbox webhooks to update the snapshot when not nil
+	webhook *webhookReceiver
+
+	transferViews *transferViews
+	// journal keeps zone differences for IXFR when not nil
+	journal *journal
+	// changes reports zone changes between snapshot updates when not nil
+	changes *changeTracker
+	// notify sends NOTIFY to secondaries on serial changes when not nil
+	notify *notifier
+	// ipam serves records for IPAM IP addresses when not nil
+	ipam *ipamSource
+	// hosts serve records for devices and virtual machines
+	hosts []*hostSource
+	// services serve SRV records for services of devices and virtual machines
+	services []*serviceSource
+	// synthesizePTR answers reverse queries without a PTR record from
+	// the A and AAAA records holding the address
+	synthesizePTR bool
+	// dnssec signs responses for zones with configured keys when not nil
+	dnssec *dnssecSigner
+	// ecs selects views by the client subnet of requests when not nil
+	ecs *ecsConfig
+	// viewMapping selects views by TSIG key or listener when not nil
+	viewMapping *viewMapping
+	// updates accepts dynamic updates when not nil
+	updates *updateConfig
+	// tsig verifies TSIG keys and restricts operations to them when not nil
+	tsig *tsigConfig
+	// acl restricts the clients that may query zones when not nil
+	acl *aclConfig
+	// zoneStatus and recordStatus are the statuses of the zones and records
+	// served. Objects of every status are served if empty.
+	zoneStatus   []string
+	recordStatus []string
+	// zoneFilter limits the served zones by tenant, tag and query parameters
+	zoneFilter netbox.ZoneQuery
+	// parked are the placeholder addresses of names in parked zones
+	parked []netip.Addr
+	// queryTimeout bounds the time spent on Netbox requests for a single
+	// query. A zero value disables the deadline.
+	queryTimeout time.Duration
+	// lifetime is cancelled on shutdown, which cancels the Netbox requests
+	// in flight
+	lifetime       context.Context
+	cancelLifetime context.CancelFunc
+	// viewOrder ranks views with equally specific prefixes by name
+	viewOrder []string
+	// fallbackView is the name of the view of clients outside all view
+	// prefixes. The Netbox default view is used if empty.
+	fallbackView string
 }
 
 func NewNetboxDNS() *NetboxDNS {
+	lifetime, cancelLifetime := context.WithCancel(context.Background())
 	return &NetboxDNS{
 		requestClient: &netbox.APIRequestClient{
 			Client: &http.Client{
 				Timeout: defaultHTTPClientTimeout,
 			},
 		},
-		zones: []string{"."},
+		zones:          []string{"."},
+		snapshot:       newSnapshot(),
+		transferViews:  newTransferViews(),
+		zoneStatus:     defaultZoneStatus,
+		recordStatus:   defaultRecordStatus,
+		lifetime:       lifetime,
+		cancelLifetime: cancelLifetime,
+	}
+}
+
+// backgroundContext returns the context of Netbox requests made outside of
+// queries, which is cancelled on shutdown
+func (netboxdns *NetboxDNS) backgroundContext() context.Context {
+	if netboxdns.lifetime == nil {
+		return context.Background()
+	}
+	return netboxdns.lifetime
+}
+
+// queryContext returns the context of the Netbox requests for a query. It is
+// cancelled with reqContext, on shutdown and after the query timeout, and
+// caches what is fetched from Netbox for the query.
+func (netboxdns *NetboxDNS) queryContext(
+	reqContext context.Context,
+) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(
+		context.WithValue(reqContext, queryCacheKey{}, &queryCache{}),
+	)
+	stop := context.AfterFunc(netboxdns.backgroundContext(), cancel)
+	if netboxdns.queryTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, netboxdns.queryTimeout)
+		return ctx, func() {
+			cancelTimeout()
+			stop()
+			cancel()
+		}
 	}
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// shutdown cancels the Netbox requests in flight
+func (netboxdns *NetboxDNS) shutdown() error {
+	if netboxdns.cancelLifetime != nil {
+		netboxdns.cancelLifetime()
+	}
+	return nil
 }
 
 // Name implements the plugin.Handler interface
@@ -72,10 +187,65 @@ func (netboxdns *NetboxDNS) ServeDNS(
 		return netboxdns.nextOrFailure(reqContext, respWriter, reqMsg)
 	}
 
-	response, err := netboxdns.lookup(qname, reqIP, qtype, family)
+	respWriter, answered := netboxdns.authorize(respWriter, reqMsg, qname, qtype)
+	if answered {
+		return dns.RcodeSuccess, nil
+	}
+
+	// the Netbox requests of the query share its deadline; the next plugin
+	// is called with the context of the request
+	ctx, cancel := netboxdns.queryContext(reqContext)
+	defer cancel()
+
+	// the ACL applies to the address of the sender in every view
+	answered, err = netboxdns.checkACL(ctx, respWriter, reqMsg, qname, reqIP)
 	if err != nil {
 		return dns.RcodeServerFailure, err
 	}
+	if answered {
+		return dns.RcodeSuccess, nil
+	}
+
+	// a view selected by TSIG key or listener overrides the view prefixes
+	viewName := netboxdns.requestView(state)
+
+	if reqMsg.Opcode == dns.OpcodeUpdate {
+		return netboxdns.serveUpdate(ctx, respWriter, reqMsg, reqIP, viewName)
+	}
+
+	// zone transfers are served by the transfer plugin through Transfer
+	if isTransfer(qtype) {
+		return netboxdns.serveTransfer(reqContext, respWriter, reqMsg, qname, reqIP, viewName)
+	}
+
+	if qtype == dns.TypeDNSKEY && len(netboxdns.dnssec.zoneKeys(qname)) > 0 {
+		return netboxdns.serveDNSKEY(respWriter, reqMsg, qname, state.Do())
+	}
+
+	// views are selected for the client behind a trusted resolver if it
+	// sends a client subnet; a source prefix length of zero asks for none
+	clientIP := reqIP
+	subnet, clientPrefix, useSubnet := netboxdns.clientSubnet(reqMsg, reqIP)
+	if viewName != "" {
+		// the answer is the same for every client subnet
+		clientPrefix = netip.Prefix{}
+	}
+	if useSubnet && clientPrefix.Bits() > 0 {
+		clientIP = clientPrefix.Addr()
+	}
+
+	server := metrics.WithServer(reqContext)
+	qtypeLabel := dns.TypeToString[qtype]
+
+	response, err := netboxdns.lookup(ctx, qname, clientIP, viewName, qtype, family)
+	if err != nil {
+		requestCount.WithLabelValues(server, "", "", qtypeLabel, resultServFail).Inc()
+		return dns.RcodeServerFailure, err
+	}
+	zoneLabel, viewLabel := "", ""
+	if response.Zone != nil {
+		zoneLabel, viewLabel = response.Zone.Name, response.Zone.View.Name
+	}
 	if response.LookupResult == lookupNameError {
 		if netboxdns.fall.Through(qname) {
 			logger.Debugf(
@@ -83,6 +253,7 @@ func (netboxdns *NetboxDNS) ServeDNS(
 				dns.TypeToString[qtype],
 				qname,
 			)
+			requestCount.WithLabelValues(server, zoneLabel, viewLabel, qtypeLabel, resultFallthrough).Inc()
 			return netboxdns.nextOrFailure(reqContext, respWriter, reqMsg)
 		} else {
 			logger.Debugf(
@@ -107,8 +278,39 @@ func (netboxdns *NetboxDNS) ServeDNS(
 		respMsg.Rcode = dns.RcodeNameError
 	case lookupDelegation:
 		respMsg.Authoritative = false
+	case lookupNoData:
+	}
+
+	if state.Do() && response.Zone != nil && netboxdns.dnssec != nil {
+		if err := netboxdns.signResponse(ctx, respMsg, response, qname); err != nil {
+			requestCount.WithLabelValues(server, zoneLabel, viewLabel, qtypeLabel, resultServFail).Inc()
+			return dns.RcodeServerFailure, err
+		}
+	}
+
+	if response.LookupResult == lookupNameError || response.LookupResult == lookupNoData {
+		negativeTTL(respMsg.Ns)
+	}
+
+	if useSubnet {
+		scope := 0
+		if clientPrefix.Bits() > 0 {
+			scope, err = netboxdns.ecsScope(ctx, clientPrefix)
+			if err != nil {
+				requestCount.WithLabelValues(server, zoneLabel, viewLabel, qtypeLabel, resultServFail).Inc()
+				return dns.RcodeServerFailure, err
+			}
+		}
+		setClientSubnet(respMsg, reqMsg, subnet, scope)
 	}
 
+	requestCount.WithLabelValues(
+		server,
+		zoneLabel,
+		viewLabel,
+		qtypeLabel,
+		lookupResultLabel(response.LookupResult),
+	).Inc()
 	respWriter.WriteMsg(respMsg)
 	return dns.RcodeSuccess, nil
 }
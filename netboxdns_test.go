@@ -2,6 +2,7 @@ package netboxdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -148,6 +149,9 @@ var (
 		test.NS("subtwo.example.com. 3600 IN NS dns01.example.com."),
 		test.NS("subtwo.example.com. 3600 IN NS dns02.example.com."),
 	}
+	exampledotcomNegativeSOA []dns.RR = []dns.RR{
+		test.SOA("example.com. 3600 IN SOA dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600"),
+	}
 	exampledotcomNS1Record4 dns.RR   = test.A("dns01.example.com. 3600 IN A 10.0.0.10")
 	exampledotcomNS2Record4 dns.RR   = test.A("dns02.example.com. 3600 IN A 10.0.0.11")
 	exampledotcomNSAddr4    []dns.RR = []dns.RR{
@@ -336,8 +340,7 @@ var (
 		},
 		{
 			Qname: exampledotcomName, Qtype: dns.TypeA,
-			Ns:    exampledotcomNS,
-			Extra: exampledotcomNSAddr4,
+			Ns: exampledotcomNegativeSOA,
 		},
 		{
 			Qname: "aservice.example.com.", Qtype: dns.TypeA,
@@ -514,8 +517,7 @@ var (
 		},
 		{
 			Qname: exampledotcomName, Qtype: dns.TypeAAAA,
-			Ns:    exampledotcomNS,
-			Extra: exampledotcomNSAddr6,
+			Ns: exampledotcomNegativeSOA,
 		},
 		{
 			Qname: "aservice.example.com.", Qtype: dns.TypeAAAA,
@@ -692,6 +694,7 @@ var (
 		{
 			Qname: "noop.example.com.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
+			Ns:    exampledotcomNegativeSOA,
 		},
 	}
 
@@ -699,6 +702,7 @@ var (
 		{
 			Qname: "noop.example.com.", Qtype: dns.TypeAAAA,
 			Rcode: dns.RcodeNameError,
+			Ns:    exampledotcomNegativeSOA,
 		},
 	}
 )
@@ -817,3 +821,79 @@ func TestUnhandledZone(t *testing.T) {
 		t.Errorf("expected no error, got %v", err)
 	}
 }
+
+func TestLookupNegative(t *testing.T) {
+	soa := []dns.RR{
+		test.SOA("example.com. 3600 IN SOA dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600"),
+	}
+	tcs := []test.Case{
+		{Qname: "noop.example.com.", Qtype: dns.TypeA, Rcode: dns.RcodeNameError, Ns: soa},
+		{Qname: "web.example.com.", Qtype: dns.TypeMX, Ns: soa},
+		{Qname: "example.com.", Qtype: dns.TypeA, Ns: soa},
+		{Qname: "b.example.com.", Qtype: dns.TypeA, Ns: soa},
+		{Qname: "noop.sub.example.com.", Qtype: dns.TypeA, Rcode: dns.RcodeNameError},
+	}
+	netboxdns := newTestPlugin(t)
+	for _, tc := range tcs {
+		t.Run(tc.Qname+" "+dns.TypeToString[tc.Qtype], func(t *testing.T) {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			_, err := netboxdns.ServeDNS(context.Background(), rec, tc.Msg())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+				t.Error(err)
+			}
+			if !rec.Msg.Authoritative {
+				t.Error("negative response is not authoritative")
+			}
+		})
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	netboxdns := newTestPlugin(t, withBlockingAPI())
+	netboxdns.queryTimeout = 50 * time.Millisecond
+
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	start := time.Now()
+	rcode, err := netboxdns.ServeDNS(context.Background(), rec, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if rcode != dns.RcodeServerFailure {
+		t.Errorf("expected rcode %s, got %s", dns.RcodeToString[dns.RcodeServerFailure], dns.RcodeToString[rcode])
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query took %v, expected it to be cancelled after the query timeout", elapsed)
+	}
+}
+
+func TestShutdownCancelsRequests(t *testing.T) {
+	netboxdns := newTestPlugin(t, withBlockingAPI())
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := netboxdns.queryContext(context.Background())
+		defer cancel()
+		_, err := netboxdns.getZones(ctx)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := netboxdns.shutdown(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not cancelled on shutdown")
+	}
+	if err := netboxdns.backgroundContext().Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the background context to be cancelled, got %v", err)
+	}
+}
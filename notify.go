@@ -0,0 +1,180 @@
+package netboxdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultNotifyAttempts int           = 5
+	defaultNotifyBackoff  time.Duration = time.Second
+	defaultNotifyTimeout  time.Duration = time.Second * 2
+)
+
+// notifier sends RFC 1996 NOTIFY messages to secondaries when the SOA serial
+// of a zone changes
+type notifier struct {
+	// targets maps zone names to secondary addresses. An empty list means the
+	// name servers of the zone are notified.
+	targets  map[string][]string
+	attempts int
+	backoff  time.Duration
+	client   *dns.Client
+	stop     chan struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		targets:  make(map[string][]string),
+		attempts: defaultNotifyAttempts,
+		backoff:  defaultNotifyBackoff,
+		client: &dns.Client{
+			Net:     "udp",
+			Timeout: defaultNotifyTimeout,
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+func (n *notifier) stopNotify() error {
+	close(n.stop)
+	return nil
+}
+
+// notifyZone sends NOTIFY for the zone of change if its serial increased. It
+// is called with the change tracker locked, so the secondaries are resolved
+// in the background.
+func (netboxdns *NetboxDNS) notifyZone(change zoneChange) {
+	if !change.serialChanged() ||
+		!serialNewer(change.newSOA.Serial, change.oldSOA.Serial) {
+		return
+	}
+	go func() {
+		targets := netboxdns.notifyTargets(netboxdns.backgroundContext(), change.zone)
+		if len(targets) == 0 {
+			logger.Debugf("no secondaries to notify for zone %q", change.zone.Name)
+			return
+		}
+		logger.Debugf(
+			"zone %q in view %q changed to serial %d; notifying %v",
+			change.zone.Name,
+			change.zone.View.Name,
+			change.newSOA.Serial,
+			targets,
+		)
+		for _, target := range targets {
+			go netboxdns.notify.send(change.newSOA, target)
+		}
+	}()
+}
+
+// notifyTargets returns the addresses to notify for zone. Configured
+// addresses take precedence over the name servers of the zone, of which the
+// primary in the SOA MNAME is not notified (RFC 1996 section 3.6).
+func (netboxdns *NetboxDNS) notifyTargets(ctx context.Context, zone netbox.Zone) []string {
+	zoneNames := make([]string, 0, len(netboxdns.notify.targets))
+	for name := range netboxdns.notify.targets {
+		zoneNames = append(zoneNames, name)
+	}
+	match := plugin.Zones(zoneNames).Matches(dns.Fqdn(zone.Name))
+	if match == "" {
+		return nil
+	}
+	if addresses := netboxdns.notify.targets[match]; len(addresses) > 0 {
+		return addresses
+	}
+	var out []string
+	for _, nameServer := range zone.NameServers {
+		if zone.SOAMName != nil &&
+			dns.CanonicalName(nameServer.Name) == dns.CanonicalName(zone.SOAMName.Name) {
+			continue
+		}
+		for _, address := range netboxdns.resolveNameServer(ctx, nameServer.Name) {
+			out = append(out, net.JoinHostPort(address, "53"))
+		}
+	}
+	return out
+}
+
+// resolveNameServer returns the addresses of a name server, preferring
+// records in Netbox over the system resolver
+func (netboxdns *NetboxDNS) resolveNameServer(ctx context.Context, name string) []string {
+	records, err := netboxdns.getRecords(ctx, &netbox.RecordQuery{
+		FQDN: strings.TrimSuffix(name, "."),
+		Type: []string{"A", "AAAA"},
+	})
+	if err == nil && len(records) > 0 {
+		out := make([]string, 0, len(records))
+		for _, record := range records {
+			out = append(out, record.Value)
+		}
+		return out
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultNotifyTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err != nil {
+		logger.Warningf("could not resolve name server %q to notify: %v", name, err)
+		return nil
+	}
+	return addresses
+}
+
+// send delivers a NOTIFY for soa to target, retrying with exponential backoff
+// until it is acknowledged or all attempts are used
+func (n *notifier) send(soa *dns.SOA, target string) {
+	msg := new(dns.Msg)
+	msg.SetNotify(soa.Hdr.Name)
+	msg.Answer = []dns.RR{soa}
+
+	backoff := n.backoff
+	var lastErr error
+	for attempt := 1; attempt <= n.attempts; attempt++ {
+		resp, _, err := n.client.Exchange(msg, target)
+		switch {
+		case err != nil:
+			lastErr = err
+		case resp.Rcode != dns.RcodeSuccess:
+			lastErr = &notifyRcodeError{rcode: resp.Rcode}
+		default:
+			logger.Debugf(
+				"NOTIFY for %q serial %d acknowledged by %s",
+				soa.Hdr.Name,
+				soa.Serial,
+				target,
+			)
+			return
+		}
+		if attempt == n.attempts {
+			break
+		}
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	logger.Warningf(
+		"NOTIFY for %q serial %d not acknowledged by %s after %d attempts: %v",
+		soa.Hdr.Name,
+		soa.Serial,
+		target,
+		n.attempts,
+		lastErr,
+	)
+}
+
+type notifyRcodeError struct {
+	rcode int
+}
+
+func (err *notifyRcodeError) Error() string {
+	return "secondary responded " + dns.RcodeToString[err.rcode]
+}
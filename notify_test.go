@@ -0,0 +1,133 @@
+package netboxdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func testNotifyServer(t *testing.T, rcode int) (string, <-chan *dns.Msg) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	received := make(chan *dns.Msg, 10)
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			received <- r
+			m := new(dns.Msg)
+			m.SetRcode(r, rcode)
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String(), received
+}
+
+func testZoneChange(zone netbox.Zone, oldSerial uint32, newSerial uint32) zoneChange {
+	soa := func(serial uint32) *dns.SOA {
+		return &dns.SOA{
+			Hdr:    dns.RR_Header{Name: dns.Fqdn(zone.Name), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+			Ns:     "dns01.example.com.",
+			Mbox:   "admin.example.com.",
+			Serial: serial,
+		}
+	}
+	return zoneChange{zone: zone, oldSOA: soa(oldSerial), newSOA: soa(newSerial)}
+}
+
+func TestNotify(t *testing.T) {
+	addr, received := testNotifyServer(t, dns.RcodeSuccess)
+	netboxdns := &NetboxDNS{snapshot: testSnapshot(), notify: newNotifier()}
+	netboxdns.notify.targets["example.com."] = []string{addr}
+	zone, _ := netboxdns.snapshot.getZone(1)
+
+	netboxdns.notifyZone(testZoneChange(zone, 1, 1))
+	netboxdns.notifyZone(testZoneChange(zone, 1, 2))
+	select {
+	case msg := <-received:
+		if msg.Opcode != dns.OpcodeNotify {
+			t.Errorf("got opcode %s, want NOTIFY", dns.OpcodeToString[msg.Opcode])
+		}
+		if msg.Question[0].Name != "example.com." {
+			t.Errorf("got notify for %q, want example.com.", msg.Question[0].Name)
+		}
+		if soa, ok := msg.Answer[0].(*dns.SOA); !ok || soa.Serial != 2 {
+			t.Errorf("expected SOA with serial 2 in answer, got %v", msg.Answer)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("no NOTIFY received")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("unexpected NOTIFY for unchanged serial: %v", msg)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	addr, received := testNotifyServer(t, dns.RcodeRefused)
+	n := newNotifier()
+	n.attempts = 3
+	n.backoff = time.Millisecond
+	zone := netbox.Zone{ID: 1, Name: "example.com"}
+	n.send(testZoneChange(zone, 1, 2).newSOA, addr)
+	if len(received) != 3 {
+		t.Errorf("got %d attempts, want 3", len(received))
+	}
+}
+
+func TestNotifyTargetsFromNameServers(t *testing.T) {
+	ttl := uint32(3600)
+	netboxdns := &NetboxDNS{snapshot: testSnapshot(), notify: newNotifier()}
+	netboxdns.notify.targets["."] = nil
+	zone, _ := netboxdns.snapshot.getZone(1)
+	zone.NameServers = []netbox.SOAMName{{Name: "web.example.com"}}
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 3, Name: "web", Type: "AAAA", Value: "2001:db8::17", FQDN: "web.example.com.", Zone: zone, TTL: &ttl})
+	targets := netboxdns.notifyTargets(context.Background(), zone)
+	want := []string{"10.0.0.17:53", "[2001:db8::17]:53"}
+	if len(targets) != len(want) {
+		t.Fatalf("got targets %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("got target %q, want %q", targets[i], want[i])
+		}
+	}
+	// the primary name server is not notified
+	zone.SOAMName = &netbox.SOAMName{Name: "web.example.com."}
+	if targets := netboxdns.notifyTargets(context.Background(), zone); len(targets) != 0 {
+		t.Errorf("expected no targets for the SOA MNAME, got %v", targets)
+	}
+	netboxdns.notify.targets = map[string][]string{"example.net.": nil}
+	if targets := netboxdns.notifyTargets(context.Background(), zone); len(targets) != 0 {
+		t.Errorf("expected no targets for unconfigured zone, got %v", targets)
+	}
+}
+
+func TestNotifyResolvesInBackground(t *testing.T) {
+	netboxdns := newTestPlugin(t, withBlockingAPI())
+	netboxdns.notify = newNotifier()
+	netboxdns.notify.targets["."] = nil
+	defer netboxdns.shutdown()
+	zone := netbox.Zone{ID: 1, Name: "example.com", NameServers: []netbox.SOAMName{{Name: "ns2.example.com"}}}
+
+	// the name server lookup blocks until shutdown
+	done := make(chan struct{})
+	go func() {
+		netboxdns.notifyZone(testZoneChange(zone, 1, 2))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notifyZone waited for the name servers to be resolved")
+	}
+}
@@ -1,14 +1,24 @@
 package netboxdns
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/tls"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
 )
 
 type tokenFuncMap map[string]func(*caddy.Controller, *NetboxDNS) error
@@ -17,11 +27,43 @@ var tokenFuncs tokenFuncMap
 
 func init() {
 	tokenFuncs = tokenFuncMap{
-		"fallthrough": parseFallthrough,
-		"timeout":     parseTimeout,
-		"tls":         parseTLS,
-		"token":       parseToken,
-		"url":         parseUrl,
+		"acl":              parseACL,
+		"acl_field":        parseACLField,
+		"acl_tag":          parseACLTag,
+		"changelog":        parseChangelog,
+		"circuit_breaker":  parseCircuitBreaker,
+		"devices":          parseHosts,
+		"dnssec":           parseDNSSEC,
+		"ecs":              parseECS,
+		"fallback_view":    parseFallbackView,
+		"fallthrough":      parseFallthrough,
+		"ipam":             parseIPAM,
+		"ipam_precedence":  parseIPAMPrecedence,
+		"ixfr":             parseIXFR,
+		"notify":           parseNotify,
+		"parked":           parseParked,
+		"query_timeout":    parseQueryTimeout,
+		"record_status":    parseRecordStatus,
+		"refresh":          parseRefresh,
+		"retry":            parseRetry,
+		"services":         parseServices,
+		"synthesize_ptr":   parseSynthesizePTR,
+		"tag":              parseTag,
+		"tenant":           parseTenant,
+		"timeout":          parseTimeout,
+		"tls":              parseTLS,
+		"token":            parseToken,
+		"tsig_acl":         parseTSIGACL,
+		"tsig_key":         parseTSIGKey,
+		"update":           parseUpdate,
+		"url":              parseUrl,
+		"view_listen":      parseViewListen,
+		"view_order":       parseViewOrder,
+		"view_tsig":        parseViewTSIG,
+		"virtual_machines": parseHosts,
+		"webhook":          parseWebhook,
+		"zone_filter":      parseZoneFilter,
+		"zone_status":      parseZoneStatus,
 	}
 }
 
@@ -43,8 +85,9 @@ func Parse(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 		return err
 	}
 
-	fullPluginURL := netboxdns.requestClient.NetboxURL.JoinPath(
-		"api",
+	apiURL := netboxdns.requestClient.NetboxURL.JoinPath("api")
+	netboxdns.requestClient.APIURL = apiURL
+	fullPluginURL := apiURL.JoinPath(
 		"plugins",
 		"netbox-dns",
 	)
@@ -102,6 +145,186 @@ func unknownToken(controller *caddy.Controller, unknownToken string) error {
 	)
 }
 
+func parseChangelog(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	netboxdns.changelog = &changelogSync{resync: defaultChangelogResync}
+	if !controller.NextArg() {
+		return nil
+	}
+	duration, err := time.ParseDuration(controller.Val())
+	if err != nil {
+		return controller.Errf(
+			`there was an error parsing "changelog": %q`,
+			err.Error(),
+		)
+	}
+	if duration <= 0 {
+		return controller.Err(`"changelog" resync must be greater than zero`)
+	}
+	netboxdns.changelog.resync = duration
+	return nil
+}
+
+func parseHosts(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	kind := controller.Val()
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Errf(`no zone for %q provided`, kind)
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for %q`, args[0], kind)
+	}
+	source := newHostSource(kind, zone[0])
+	templateSet := false
+	for _, arg := range args[1:] {
+		key, value, found := strings.Cut(arg, "=")
+		switch {
+		case found && key == "site":
+			source.query.Site = append(source.query.Site, value)
+		case found && key == "role":
+			source.query.Role = append(source.query.Role, value)
+		case found && key == "tenant":
+			source.query.Tenant = append(source.query.Tenant, value)
+		case found && key == "tag":
+			source.query.Tag = append(source.query.Tag, value)
+		case templateSet:
+			return controller.Errf(`unexpected argument %q for %q`, arg, kind)
+		default:
+			nameTemplate, err := template.New(kind).Parse(arg)
+			if err != nil {
+				return controller.Errf(
+					`there was an error parsing %q template: %q`,
+					kind,
+					err.Error(),
+				)
+			}
+			source.template = nameTemplate
+			templateSet = true
+		}
+	}
+	netboxdns.hosts = append(netboxdns.hosts, source)
+	return nil
+}
+
+func parseServices(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no zone for "services" provided`)
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for "services"`, args[0])
+	}
+	source := newServiceSource(zone[0])
+	for _, arg := range args[1:] {
+		name, label, found := strings.Cut(arg, "=")
+		if !found || name == "" || label == "" {
+			return controller.Errf(`invalid label mapping %q for "services"`, arg)
+		}
+		source.labels[name] = strings.TrimPrefix(label, "_")
+	}
+	netboxdns.services = append(netboxdns.services, source)
+	return nil
+}
+
+func parseECS(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no trusted resolvers for "ecs" provided`)
+	}
+	netboxdns.ecs = &ecsConfig{}
+	for _, arg := range args {
+		prefix, err := netip.ParsePrefix(arg)
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "ecs" trusted prefix: %q`,
+				err.Error(),
+			)
+		}
+		netboxdns.ecs.trusted = append(netboxdns.ecs.trusted, prefix.Masked())
+	}
+	return nil
+}
+
+func parseViewTSIG(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) != 2 {
+		return controller.Err(`"view_tsig" requires a key name and a view`)
+	}
+	if netboxdns.viewMapping == nil {
+		netboxdns.viewMapping = newViewMapping()
+	}
+	netboxdns.viewMapping.tsig[fqdnKey(args[0])] = args[1]
+	return nil
+}
+
+func parseViewListen(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) != 2 {
+		return controller.Err(`"view_listen" requires an address and a view`)
+	}
+	addr, port, ok := parseListener(args[0])
+	if !ok {
+		return controller.Errf(`invalid address %q for "view_listen"`, args[0])
+	}
+	if netboxdns.viewMapping == nil {
+		netboxdns.viewMapping = newViewMapping()
+	}
+	netboxdns.viewMapping.listeners = append(
+		netboxdns.viewMapping.listeners,
+		listenerView{addr: addr, port: port, view: args[1]},
+	)
+	return nil
+}
+
+func parseViewOrder(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no views for "view_order" provided`)
+	}
+	netboxdns.viewOrder = append(netboxdns.viewOrder, args...)
+	return nil
+}
+
+func parseFallbackView(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) != 1 {
+		return controller.Err(`"fallback_view" requires exactly one view`)
+	}
+	netboxdns.fallbackView = args[0]
+	return nil
+}
+
+func parseDNSSEC(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) < 2 {
+		return controller.Err(`"dnssec" requires a zone and at least one key`)
+	}
+	if netboxdns.dnssec == nil {
+		netboxdns.dnssec = newDNSSECSigner()
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for "dnssec"`, args[0])
+	}
+	for _, base := range args[1:] {
+		key, err := readZoneKey(base)
+		if err != nil {
+			return controller.Errf(
+				`there was an error reading "dnssec" key: %q`,
+				err.Error(),
+			)
+		}
+		if err := netboxdns.dnssec.addKey(zone[0], key); err != nil {
+			return controller.Errf(
+				`there was an error reading "dnssec" key: %q`,
+				err.Error(),
+			)
+		}
+	}
+	return nil
+}
+
 func parseFallthrough(
 	controller *caddy.Controller,
 	netboxdns *NetboxDNS,
@@ -125,6 +348,429 @@ func parseTimeout(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 	return nil
 }
 
+func parseQueryTimeout(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	if !controller.NextArg() {
+		return controller.Err(`no value for "query_timeout" provided`)
+	}
+	duration, err := time.ParseDuration(controller.Val())
+	if err != nil {
+		return controller.Errf(
+			`there was an error parsing "query_timeout": %q`,
+			err.Error(),
+		)
+	}
+	if duration <= 0 {
+		return controller.Err(`"query_timeout" must be greater than zero`)
+	}
+	netboxdns.queryTimeout = duration
+	return nil
+}
+
+func parseRetry(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	policy := &netbox.RetryPolicy{
+		Attempts:   defaultRetryAttempts,
+		Backoff:    defaultRetryBackoff,
+		MaxBackoff: defaultRetryMaxBackoff,
+	}
+	args := controller.RemainingArgs()
+	if len(args) > 3 {
+		return controller.Err(`"retry" takes at most attempts, a backoff and a maximum backoff`)
+	}
+	if len(args) > 0 {
+		attempts, err := strconv.Atoi(args[0])
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "retry" attempts: %q`,
+				err.Error(),
+			)
+		}
+		if attempts <= 0 {
+			return controller.Err(`"retry" attempts must be greater than zero`)
+		}
+		policy.Attempts = attempts
+	}
+	durations := []*time.Duration{&policy.Backoff, &policy.MaxBackoff}
+	for i, arg := range args[min(len(args), 1):] {
+		duration, err := time.ParseDuration(arg)
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "retry" backoff: %q`,
+				err.Error(),
+			)
+		}
+		if duration <= 0 {
+			return controller.Err(`"retry" backoff must be greater than zero`)
+		}
+		*durations[i] = duration
+	}
+	if policy.Backoff > policy.MaxBackoff {
+		return controller.Err(`"retry" backoff must not exceed the maximum backoff`)
+	}
+	netboxdns.requestClient.Retry = policy
+	return nil
+}
+
+func parseCircuitBreaker(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	breaker := &netbox.CircuitBreaker{
+		Threshold: defaultBreakerThreshold,
+		Cooldown:  defaultBreakerCooldown,
+	}
+	args := controller.RemainingArgs()
+	if len(args) > 2 {
+		return controller.Err(`"circuit_breaker" takes at most failures and a cooldown`)
+	}
+	if len(args) > 0 {
+		threshold, err := strconv.Atoi(args[0])
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "circuit_breaker" failures: %q`,
+				err.Error(),
+			)
+		}
+		if threshold <= 0 {
+			return controller.Err(`"circuit_breaker" failures must be greater than zero`)
+		}
+		breaker.Threshold = threshold
+	}
+	if len(args) > 1 {
+		cooldown, err := time.ParseDuration(args[1])
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "circuit_breaker" cooldown: %q`,
+				err.Error(),
+			)
+		}
+		if cooldown <= 0 {
+			return controller.Err(`"circuit_breaker" cooldown must be greater than zero`)
+		}
+		breaker.Cooldown = cooldown
+	}
+	netboxdns.requestClient.Breaker = breaker
+	return nil
+}
+
+func parseIPAM(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	zones := netboxdns.zones
+	if args := controller.RemainingArgs(); len(args) > 0 {
+		zones = nil
+		for _, arg := range args {
+			zones = append(zones, plugin.Host(arg).NormalizeExact()...)
+		}
+		if len(zones) == 0 {
+			return controller.Errf(`invalid zones %q for "ipam"`, args)
+		}
+	}
+	if netboxdns.ipam == nil {
+		netboxdns.ipam = newIPAMSource()
+	}
+	netboxdns.ipam.zones = zones
+	return nil
+}
+
+func parseUpdate(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	zones := netboxdns.zones
+	if args := controller.RemainingArgs(); len(args) > 0 {
+		zones = nil
+		for _, arg := range args {
+			zones = append(zones, plugin.Host(arg).NormalizeExact()...)
+		}
+		if len(zones) == 0 {
+			return controller.Errf(`invalid zones %q for "update"`, args)
+		}
+	}
+	netboxdns.updates = &updateConfig{zones: zones}
+	return nil
+}
+
+func parseACL(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) < 3 {
+		return controller.Err(`"acl" requires a zone, an action and at least one network`)
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for "acl"`, args[0])
+	}
+	rule, err := parseACLRule(args[1:])
+	if err != nil {
+		return controller.Errf(`invalid rule for "acl": %s`, err.Error())
+	}
+	if netboxdns.acl == nil {
+		netboxdns.acl = newACLConfig()
+	}
+	netboxdns.acl.zones[zone[0]] = append(netboxdns.acl.zones[zone[0]], rule)
+	return nil
+}
+
+func parseACLTag(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) < 3 {
+		return controller.Err(`"acl_tag" requires a tag, an action and at least one network`)
+	}
+	rule, err := parseACLRule(args[1:])
+	if err != nil {
+		return controller.Errf(`invalid rule for "acl_tag": %s`, err.Error())
+	}
+	if netboxdns.acl == nil {
+		netboxdns.acl = newACLConfig()
+	}
+	slug := args[0]
+	if _, ok := netboxdns.acl.tags[slug]; !ok {
+		netboxdns.acl.tagOrder = append(netboxdns.acl.tagOrder, slug)
+	}
+	netboxdns.acl.tags[slug] = append(netboxdns.acl.tags[slug], rule)
+	return nil
+}
+
+func parseACLField(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) != 1 {
+		return controller.Err(`"acl_field" requires exactly one custom field`)
+	}
+	if netboxdns.acl == nil {
+		netboxdns.acl = newACLConfig()
+	}
+	netboxdns.acl.field = args[0]
+	return nil
+}
+
+func parseTenant(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no tenants for "tenant" provided`)
+	}
+	netboxdns.zoneFilter.Tenant = append(netboxdns.zoneFilter.Tenant, args...)
+	return nil
+}
+
+func parseTag(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no tags for "tag" provided`)
+	}
+	netboxdns.zoneFilter.Tag = append(netboxdns.zoneFilter.Tag, args...)
+	return nil
+}
+
+func parseZoneFilter(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no filters for "zone_filter" provided`)
+	}
+	if netboxdns.zoneFilter.Params == nil {
+		netboxdns.zoneFilter.Params = make(url.Values)
+	}
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			return controller.Errf(`invalid filter %q for "zone_filter"`, arg)
+		}
+		netboxdns.zoneFilter.Params.Add(key, value)
+	}
+	return nil
+}
+
+func parseZoneStatus(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no statuses for "zone_status" provided`)
+	}
+	for _, status := range args {
+		switch status {
+		case netbox.ZoneStatusActive, netbox.ZoneStatusReserved,
+			netbox.ZoneStatusDeprecated, netbox.ZoneStatusParked,
+			netbox.ZoneStatusDynamic:
+		default:
+			return controller.Errf(`invalid status %q for "zone_status"`, status)
+		}
+	}
+	netboxdns.zoneStatus = args
+	return nil
+}
+
+func parseRecordStatus(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no statuses for "record_status" provided`)
+	}
+	for _, status := range args {
+		switch status {
+		case netbox.RecordStatusActive, netbox.RecordStatusInactive:
+		default:
+			return controller.Errf(`invalid status %q for "record_status"`, status)
+		}
+	}
+	netboxdns.recordStatus = args
+	return nil
+}
+
+func parseParked(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no addresses for "parked" provided`)
+	}
+	netboxdns.parked = nil
+	for _, arg := range args {
+		addr, err := netip.ParseAddr(arg)
+		if err != nil {
+			return controller.Errf(`invalid address %q for "parked"`, arg)
+		}
+		netboxdns.parked = append(netboxdns.parked, addr.Unmap())
+	}
+	return nil
+}
+
+func parseTSIGKey(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	var secret string
+	switch {
+	case len(args) == 2:
+		secret = args[1]
+	case len(args) == 3 && args[1] == "file":
+		content, err := os.ReadFile(args[2])
+		if err != nil {
+			return controller.Errf(
+				`there was an error reading "tsig_key" secret: %q`,
+				err.Error(),
+			)
+		}
+		secret = strings.TrimSpace(string(content))
+	default:
+		return controller.Err(`"tsig_key" requires a name and a secret or file`)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil || secret == "" {
+		return controller.Errf(`invalid secret for "tsig_key" %q`, args[0])
+	}
+	if netboxdns.tsig == nil {
+		netboxdns.tsig = newTSIGConfig()
+	}
+	name := fqdnKey(args[0])
+	if _, ok := netboxdns.tsig.secrets[name]; ok {
+		return controller.Errf(`duplicate "tsig_key" %q`, args[0])
+	}
+	netboxdns.tsig.secrets[name] = secret
+	return nil
+}
+
+func parseTSIGACL(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) < 3 {
+		return controller.Err(`"tsig_acl" requires a zone, an operation and at least one key`)
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for "tsig_acl"`, args[0])
+	}
+	operation := args[1]
+	switch operation {
+	case tsigOperationQuery, tsigOperationTransfer, tsigOperationUpdate:
+	default:
+		return controller.Errf(`invalid operation %q for "tsig_acl"`, operation)
+	}
+	if netboxdns.tsig == nil {
+		netboxdns.tsig = newTSIGConfig()
+	}
+	acl := tsigACL{zone: zone[0], operation: operation, keys: make(map[string]bool)}
+	for _, key := range args[2:] {
+		acl.keys[fqdnKey(key)] = true
+	}
+	netboxdns.tsig.acls = append(netboxdns.tsig.acls, acl)
+	return nil
+}
+
+func parseIPAMPrecedence(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	if !controller.NextArg() {
+		return controller.Err(`no value for "ipam_precedence" provided`)
+	}
+	if netboxdns.ipam == nil {
+		netboxdns.ipam = newIPAMSource()
+	}
+	switch controller.Val() {
+	case "records":
+		netboxdns.ipam.precedence = ipamPrecedenceRecords
+	case "ipam":
+		netboxdns.ipam.precedence = ipamPrecedenceIPAM
+	default:
+		return controller.Errf(
+			`invalid value %q for "ipam_precedence"; expected "records" or "ipam"`,
+			controller.Val(),
+		)
+	}
+	return nil
+}
+
+func parseIXFR(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	size := defaultJournalSize
+	if controller.NextArg() {
+		value, err := strconv.Atoi(controller.Val())
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "ixfr": %q`,
+				err.Error(),
+			)
+		}
+		if value <= 0 {
+			return controller.Err(`"ixfr" journal size must be greater than zero`)
+		}
+		size = value
+	}
+	netboxdns.journal = newJournal(size)
+	return nil
+}
+
+func parseNotify(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) == 0 {
+		return controller.Err(`no zone for "notify" provided`)
+	}
+	if netboxdns.notify == nil {
+		netboxdns.notify = newNotifier()
+	}
+	zone := plugin.Host(args[0]).NormalizeExact()
+	if len(zone) == 0 {
+		return controller.Errf(`invalid zone %q for "notify"`, args[0])
+	}
+	addresses := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		address, err := parse.HostPort(arg, "53")
+		if err != nil {
+			return controller.Errf(
+				`there was an error parsing "notify" address: %q`,
+				err.Error(),
+			)
+		}
+		addresses = append(addresses, address)
+	}
+	netboxdns.notify.targets[zone[0]] = addresses
+	return nil
+}
+
+func parseRefresh(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	if !controller.NextArg() {
+		return controller.Err(`no value for "refresh" provided`)
+	}
+	duration, err := time.ParseDuration(controller.Val())
+	if err != nil {
+		return controller.Errf(
+			`there was an error parsing "refresh": %q`,
+			err.Error(),
+		)
+	}
+	if duration <= 0 {
+		return controller.Err(`"refresh" must be greater than zero`)
+	}
+	netboxdns.refresh = duration
+	return nil
+}
+
+func parseSynthesizePTR(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	if controller.NextArg() {
+		return controller.Err(`"synthesize_ptr" does not take arguments`)
+	}
+	netboxdns.synthesizePTR = true
+	return nil
+}
+
 func parseTLS(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 	args := controller.RemainingArgs()
 	tlsConfig, err := tls.NewTLSConfigFromArgs(args...)
@@ -160,6 +806,26 @@ func parseUrl(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 	return nil
 }
 
+func parseWebhook(controller *caddy.Controller, netboxdns *NetboxDNS) error {
+	args := controller.RemainingArgs()
+	if len(args) != 2 {
+		return controller.Err(
+			`"webhook" requires a listen address and a secret`,
+		)
+	}
+	if _, _, err := net.SplitHostPort(args[0]); err != nil {
+		return controller.Errf(
+			`there was an error parsing "webhook" address: %q`,
+			err.Error(),
+		)
+	}
+	netboxdns.webhook = &webhookReceiver{
+		addr:   args[0],
+		secret: args[1],
+	}
+	return nil
+}
+
 func parseValidate(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 	tokenEmpty := netboxdns.requestClient.Token == ""
 	urlEmpty := netboxdns.requestClient.NetboxURL == nil ||
@@ -175,5 +841,54 @@ func parseValidate(controller *caddy.Controller, netboxdns *NetboxDNS) error {
 	if urlEmpty {
 		return controller.Err(`value is required for "url"`)
 	}
+	if netboxdns.changelog != nil && netboxdns.refresh == 0 {
+		return controller.Err(`"changelog" requires "refresh" to be set`)
+	}
+	if netboxdns.webhook != nil && netboxdns.refresh == 0 {
+		return controller.Err(`"webhook" requires "refresh" to be set`)
+	}
+	if netboxdns.journal != nil && netboxdns.refresh == 0 {
+		return controller.Err(`"ixfr" requires "refresh" to be set`)
+	}
+	if netboxdns.ipam != nil && netboxdns.ipam.zones == nil {
+		return controller.Err(`"ipam_precedence" requires "ipam" to be set`)
+	}
+	if len(netboxdns.hosts) > 0 && netboxdns.refresh == 0 {
+		return controller.Errf(
+			`%q requires "refresh" to be set`,
+			netboxdns.hosts[0].kind,
+		)
+	}
+	if len(netboxdns.services) > 0 && len(netboxdns.hosts) == 0 {
+		return controller.Err(
+			`"services" requires "devices" or "virtual_machines" to be set`,
+		)
+	}
+	if netboxdns.ipam != nil && netboxdns.refresh == 0 {
+		return controller.Err(`"ipam" requires "refresh" to be set`)
+	}
+	if netboxdns.notify != nil && netboxdns.refresh == 0 {
+		return controller.Err(`"notify" requires "refresh" to be set`)
+	}
+	if len(netboxdns.parked) > 0 &&
+		!slices.Contains(netboxdns.zoneStatus, netbox.ZoneStatusParked) {
+		// parked zones are served in addition to the other statuses
+		netboxdns.zoneStatus = append(
+			slices.Clone(netboxdns.zoneStatus),
+			netbox.ZoneStatusParked,
+		)
+	}
+	if netboxdns.tsig != nil {
+		for _, acl := range netboxdns.tsig.acls {
+			for key := range acl.keys {
+				if _, ok := netboxdns.tsig.secrets[key]; !ok {
+					return controller.Errf(
+						`"tsig_acl" key %q requires "tsig_key" to be set`,
+						key,
+					)
+				}
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,92 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// lookupSynthesizedPTR answers a PTR query under in-addr.arpa. or ip6.arpa.
+// with the names of the A and AAAA records holding the address, looking only
+// at zones in the views of the requester. It returns nil if qname is not a reverse
+// name or no record holds the address.
+func (netboxdns *NetboxDNS) lookupSynthesizedPTR(
+	ctx context.Context,
+	qname string,
+	reqIP netip.Addr,
+	viewName string,
+) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "lookupSynthesizedPTR")
+	defer span.Finish()
+	address := dnsutil.ExtractAddressFromReverse(qname)
+	if address == "" {
+		return nil, nil
+	}
+	zones, err := netboxdns.viewZones(ctx, reqIP, viewName)
+	if err != nil {
+		return nil, err
+	}
+	records, err := netboxdns.getRecords(
+		ctx,
+		&netbox.RecordQuery{
+			Type:  []string{"A", "AAAA"},
+			Value: address,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var answer []dns.RR
+	for _, record := range records {
+		target := fqdnKey(record.FQDN)
+		if !zones[record.Zone.ID] || seen[target] {
+			continue
+		}
+		seen[target] = true
+		answer = append(answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   dns.Fqdn(qname),
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    *record.TTL,
+			},
+			Ptr: dns.Fqdn(record.FQDN),
+		})
+	}
+	if len(answer) == 0 {
+		return nil, nil
+	}
+	return &lookupResponse{
+		Answer: answer,
+		Extra:  []dns.RR{},
+	}, nil
+}
+
+// viewZones returns the IDs of the zones in the views of the client at
+// reqIP, or in the view named viewName if set
+func (netboxdns *NetboxDNS) viewZones(
+	ctx context.Context,
+	reqIP netip.Addr,
+	viewName string,
+) (map[int]bool, error) {
+	viewIDs, err := netboxdns.clientViews(ctx, reqIP, viewName)
+	if err != nil {
+		return nil, err
+	}
+	ranks := viewRanks(viewIDs)
+	managedZones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int]bool)
+	for _, zone := range managedZones {
+		if _, ok := ranks[zone.View.ID]; ok {
+			out[zone.ID] = true
+		}
+	}
+	return out, nil
+}
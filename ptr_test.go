@@ -0,0 +1,61 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestLookupSynthesizedPTR(t *testing.T) {
+	netboxdns := newTestPlugin(t)
+	netboxdns.synthesizePTR = true
+	reverse := netbox.Zone{ID: 4, Name: "1.0.10.in-addr.arpa", DefaultTTL: 3600}
+	reverse.View.ID = 1
+	netboxdns.snapshot.putZone(reverse)
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 30, Name: "10", Type: "PTR", Value: "printer.example.com.", FQDN: "10.1.0.10.in-addr.arpa.", Zone: reverse})
+	// address written in a non-canonical form
+	zone, _ := netboxdns.snapshot.getZone(1)
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 31, Name: "v6", Type: "AAAA", Value: "2001:db8:0::17", FQDN: "v6.example.com.", Zone: zone})
+
+	tcs := []test.Case{
+		{
+			Qname: "17.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Answer: []dns.RR{test.PTR("17.0.0.10.in-addr.arpa. 3600 IN PTR web.example.com.")},
+		},
+		{
+			Qname: "7.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", Qtype: dns.TypePTR,
+			Answer: []dns.RR{
+				test.PTR("7.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 300 IN PTR web.example.com."),
+				test.PTR("7.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 3600 IN PTR v6.example.com."),
+			},
+		},
+		// the record in Netbox wins over host.sub.example.com
+		{
+			Qname: "10.1.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Answer: []dns.RR{test.PTR("10.1.0.10.in-addr.arpa. 3600 IN PTR printer.example.com.")},
+		},
+		{Qname: "99.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR, Rcode: dns.RcodeNameError},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Qname, func(t *testing.T) {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			_, err := netboxdns.ServeDNS(context.Background(), rec, tc.Msg())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	netboxdns.synthesizePTR = false
+	if response, _ := netboxdns.lookup(context.Background(), "17.0.0.10.in-addr.arpa.", netip.MustParseAddr("10.240.0.1"), "", dns.TypePTR, 1); response.LookupResult != lookupNameError {
+		t.Errorf("PTR synthesized while disabled: %v", response.Answer)
+	}
+}
@@ -30,7 +30,7 @@ func recordsToRR(records []netbox.Record) ([]dns.RR, error) {
 				record.Type,
 				record.Value,
 			)
-			rr, err := dns.NewRR(rrStr)
+			rr, err := newRRInZone(rrStr, record.Zone.Name)
 			if err != nil {
 				return out, err
 			}
@@ -40,6 +40,20 @@ func recordsToRR(records []netbox.Record) ([]dns.RR, error) {
 	return out, nil
 }
 
+// newRRInZone parses s like dns.NewRR, but completes relative names in the
+// record value with the zone origin the way Netbox intends them.
+func newRRInZone(s string, zoneName string) (dns.RR, error) {
+	zoneParser := dns.NewZoneParser(strings.NewReader(s), dns.Fqdn(zoneName), "")
+	rr, ok := zoneParser.Next()
+	if !ok {
+		if err := zoneParser.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not parse record %q", s)
+	}
+	return rr, nil
+}
+
 func recordToTXT(record netbox.Record) *dns.TXT {
 	txt := make([]string, 0)
 	if strings.HasPrefix(record.Value, `"`) {
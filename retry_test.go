@@ -0,0 +1,171 @@
+package netboxdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+const testViewsPage string = `{"count":1,"next":null,"results":[{"id":1,"name":"default","default_view":true}]}`
+
+// testFlakyClient returns a client for a Netbox answering requests with
+// the status returned by fail, or the views if it returns zero. The number of
+// requests received is counted in hits.
+func testFlakyClient(
+	t *testing.T,
+	fail func(hit int32, writer http.ResponseWriter) int,
+) (*netbox.APIRequestClient, *atomic.Int32) {
+	t.Helper()
+	hits := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if status := fail(hits.Add(1), writer); status != 0 {
+			http.Error(writer, "unavailable", status)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(testViewsPage))
+	}))
+	t.Cleanup(server.Close)
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+	return &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+		Retry: &netbox.RetryPolicy{
+			Attempts:   3,
+			Backoff:    time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+		},
+	}, hits
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		fail     func(hit int32, writer http.ResponseWriter) int
+		wantErr  bool
+		wantHits int32
+	}{
+		{
+			"transient bad gateway",
+			func(hit int32, writer http.ResponseWriter) int {
+				if hit == 1 {
+					return http.StatusBadGateway
+				}
+				return 0
+			},
+			false,
+			2,
+		},
+		{
+			"rate limited with retry-after",
+			func(hit int32, writer http.ResponseWriter) int {
+				if hit == 1 {
+					writer.Header().Set("Retry-After", "0")
+					return http.StatusTooManyRequests
+				}
+				return 0
+			},
+			false,
+			2,
+		},
+		{
+			"retry-after beyond maximum backoff",
+			func(hit int32, writer http.ResponseWriter) int {
+				writer.Header().Set("Retry-After", "60")
+				return http.StatusServiceUnavailable
+			},
+			true,
+			1,
+		},
+		{
+			"persistent server error",
+			func(hit int32, writer http.ResponseWriter) int {
+				return http.StatusInternalServerError
+			},
+			true,
+			3,
+		},
+		{
+			"client error",
+			func(hit int32, writer http.ResponseWriter) int {
+				return http.StatusForbidden
+			},
+			true,
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, hits := testFlakyClient(t, tt.fail)
+			views, err := netbox.GetViews(context.Background(), client)
+			if tt.wantErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tt.wantErr && (err != nil || len(views) != 1) {
+				t.Errorf("expected one view, got %v: %v", views, err)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("expected %d requests, got %d", tt.wantHits, got)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	healthy := &atomic.Bool{}
+	client, hits := testFlakyClient(t, func(hit int32, writer http.ResponseWriter) int {
+		if healthy.Load() {
+			return 0
+		}
+		return http.StatusBadGateway
+	})
+	client.Retry = nil
+	client.Breaker = &netbox.CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := netbox.GetViews(ctx, client); err == nil {
+			t.Fatal("expected an error, got none")
+		}
+	}
+	if _, err := netbox.GetViews(ctx, client); !errors.Is(err, netbox.ErrCircuitOpen) {
+		t.Errorf("expected %v, got %v", netbox.ErrCircuitOpen, err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("expected 2 requests while the breaker is open, got %d", got)
+	}
+
+	// lookups without a snapshot fail fast
+	netboxdns := NewNetboxDNS()
+	netboxdns.zones = []string{"example.com."}
+	netboxdns.requestClient = client
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	rcode, err := netboxdns.ServeDNS(ctx, rec, req)
+	if rcode != dns.RcodeServerFailure || !errors.Is(err, netbox.ErrCircuitOpen) {
+		t.Errorf("expected SERVFAIL with %v, got %s with %v", netbox.ErrCircuitOpen, dns.RcodeToString[rcode], err)
+	}
+
+	// the request after the cooldown closes the breaker again
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	for range 2 {
+		if _, err := netbox.GetViews(ctx, client); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+	if got := hits.Load(); got != 4 {
+		t.Errorf("expected 4 requests, got %d", got)
+	}
+}
@@ -0,0 +1,126 @@
+package netboxdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// serviceSource serves SRV records for IPAM services. The target of a record
+// is the name given to the device or virtual machine of the service by a
+// devices or virtual_machines source.
+type serviceSource struct {
+	zone string
+	// labels maps service names to SRV labels without the leading underscore
+	labels map[string]string
+	// records holds the records created from services
+	records *snapshot
+}
+
+func newServiceSource(zone string) *serviceSource {
+	return &serviceSource{
+		zone:    zone,
+		labels:  make(map[string]string),
+		records: newSnapshot(),
+	}
+}
+
+// syncServices reloads all services from Netbox and rebuilds their records.
+// It must run after the host sources have been reloaded.
+func (netboxdns *NetboxDNS) syncServices(ctx context.Context, source *serviceSource) error {
+	services, err := netbox.GetServices(ctx, netboxdns.requestClient)
+	if err != nil {
+		return err
+	}
+	zones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return err
+	}
+	records := source.buildRecords(services, netboxdns.hostNames(), zones)
+	setSourceRecords(source.records, records)
+	logger.Infof(
+		"loaded %d services as %d records in %q",
+		len(services),
+		len(records),
+		source.zone,
+	)
+	return nil
+}
+
+// hostNames maps object type and ID of every device and virtual machine to
+// its name. The first source to name a host wins.
+func (netboxdns *NetboxDNS) hostNames() map[string]string {
+	out := make(map[string]string)
+	for _, source := range netboxdns.hosts {
+		for id, name := range source.names {
+			key := hostKey(source.objectType(), id)
+			if _, ok := out[key]; !ok {
+				out[key] = name
+			}
+		}
+	}
+	return out
+}
+
+func hostKey(objectType string, id int) string {
+	return fmt.Sprintf("%s/%d", objectType, id)
+}
+
+// buildRecords returns an SRV record for every port of services named
+// _label._protocol.zone
+func (source *serviceSource) buildRecords(
+	services []netbox.Service,
+	hostNames map[string]string,
+	zones []netbox.Zone,
+) []netbox.Record {
+	var out []netbox.Record
+	for _, service := range services {
+		objectType, id := service.Parent()
+		target, ok := hostNames[hostKey(objectType, id)]
+		if !ok {
+			logger.Debugf(
+				"ignoring service %q: %s %d has no name",
+				service.Name,
+				objectType,
+				id,
+			)
+			continue
+		}
+		name := fmt.Sprintf(
+			"_%s._%s.%s",
+			source.label(service.Name),
+			strings.ToLower(service.Protocol.Value),
+			source.zone,
+		)
+		if _, ok := dns.IsDomainName(name); !ok {
+			logger.Debugf("ignoring service %q: invalid name %q", service.Name, name)
+			continue
+		}
+		name = fqdnKey(name)
+		for _, port := range service.Ports {
+			for _, zone := range closestZones(name, zones) {
+				out = append(out, netbox.Record{
+					ID:    -len(out) - 1,
+					Name:  relativeName(name, zone.Name),
+					Type:  "SRV",
+					Value: fmt.Sprintf("0 0 %d %s", port, target),
+					Zone:  zone,
+					FQDN:  name,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// label returns the SRV label of the service named name. Unless configured,
+// it is the name lowercased with spaces and underscores replaced by hyphens.
+func (source *serviceSource) label(name string) string {
+	if label, ok := source.labels[name]; ok {
+		return label
+	}
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(strings.ToLower(name))
+}
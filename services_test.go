@@ -0,0 +1,85 @@
+package netboxdns
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"text/template"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestServicesBuildRecords(t *testing.T) {
+	zones := testSnapshot().getZones()
+	hostNames := map[string]string{
+		hostKey(netbox.ObjectTypeDevice, 1):         "switch.example.com.",
+		hostKey(netbox.ObjectTypeVirtualMachine, 1): "vm.sub.example.com.",
+	}
+	services := []netbox.Service{
+		{ID: 1, Name: "Web Server", Ports: []uint16{80, 8080}, Device: &netbox.NestedObject{ID: 1}},
+		{ID: 2, Name: "LDAPS", Ports: []uint16{636}, VirtualMachine: &netbox.NestedObject{ID: 1}},
+		// the device of the service has no name
+		{ID: 3, Name: "ssh", Ports: []uint16{22}, Device: &netbox.NestedObject{ID: 2}},
+	}
+	services[0].Protocol.Value = "tcp"
+	services[1].Protocol.Value = "tcp"
+	services[2].Protocol.Value = "tcp"
+	source := newServiceSource("example.com.")
+	source.labels["LDAPS"] = "ldap"
+	var got []string
+	for _, record := range source.buildRecords(services, hostNames, zones) {
+		got = append(got, record.Zone.Name+" "+record.Name+" "+record.Type+" "+record.Value)
+	}
+	want := []string{
+		"example.com _web-server._tcp SRV 0 0 80 switch.example.com.",
+		"example.com _web-server._tcp SRV 0 0 8080 switch.example.com.",
+		"example.com _ldap._tcp SRV 0 0 636 vm.sub.example.com.",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+}
+
+func TestLookupServices(t *testing.T) {
+	netboxdns := newTestPlugin(t)
+	zones := netboxdns.snapshot.getZones()
+	hosts := newHostSource(hostKindDevices, "example.com.")
+	hosts.template = template.Must(template.New("").Parse("{{.Name}}"))
+	setSourceRecords(hosts.records, hosts.buildRecords([]any{
+		netbox.Device{Host: netbox.Host{
+			ID:         1,
+			Name:       "switch",
+			PrimaryIP4: &netbox.NestedIPAddress{ID: 1, Address: "10.0.0.98/24"},
+			PrimaryIP6: &netbox.NestedIPAddress{ID: 2, Address: "2001:db8::98/64"},
+		}},
+	}, zones))
+	netboxdns.hosts = []*hostSource{hosts}
+	services := newServiceSource("example.com.")
+	service := netbox.Service{ID: 1, Name: "ssh", Ports: []uint16{22}, Device: &netbox.NestedObject{ID: 1}}
+	service.Protocol.Value = "tcp"
+	setSourceRecords(services.records, services.buildRecords(
+		[]netbox.Service{service},
+		netboxdns.hostNames(),
+		zones,
+	))
+	netboxdns.services = []*serviceSource{services}
+
+	tc := test.Case{
+		Qname: "_ssh._tcp.example.com.", Qtype: dns.TypeSRV,
+		Answer: []dns.RR{test.SRV("_ssh._tcp.example.com. 3600 IN SRV 0 0 22 switch.example.com.")},
+		Extra: []dns.RR{
+			test.A("switch.example.com. 3600 IN A 10.0.0.98"),
+			test.AAAA("switch.example.com. 3600 IN AAAA 2001:db8::98"),
+		},
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, tc.Msg()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+		t.Error(err)
+	}
+}
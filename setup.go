@@ -15,6 +15,39 @@ func setup(controller *caddy.Controller) error {
 	if err := Parse(controller, netboxdns); err != nil {
 		return err
 	}
+	if netboxdns.tsig != nil {
+		config := dnsserver.GetConfig(controller)
+		if config.TsigSecret == nil {
+			config.TsigSecret = make(map[string]string)
+		}
+		err := registerTSIGSecrets(config.TsigSecret, netboxdns.tsig.secrets)
+		if err != nil {
+			return controller.Err(err.Error())
+		}
+	}
+	if netboxdns.journal != nil {
+		tracker := netboxdns.zoneChanges()
+		tracker.onChange(netboxdns.journal.record)
+		tracker.onRemove(netboxdns.journal.drop)
+	}
+	if netboxdns.notify != nil {
+		netboxdns.zoneChanges().onChange(netboxdns.notifyZone)
+		controller.OnShutdown(netboxdns.notify.stopNotify)
+	}
+	if netboxdns.refresh > 0 {
+		controller.OnStartup(netboxdns.startRefresh)
+		controller.OnShutdown(netboxdns.stopRefresh)
+	}
+	if netboxdns.webhook != nil {
+		controller.OnStartup(netboxdns.startWebhook)
+		controller.OnShutdown(netboxdns.stopWebhook)
+	}
+	controller.OnShutdown(netboxdns.shutdown)
+	snapshotAge.add(netboxdns, serverLabels(dnsserver.GetConfig(controller)))
+	controller.OnShutdown(func() error {
+		snapshotAge.remove(netboxdns)
+		return nil
+	})
 	dnsserver.GetConfig(controller).AddPlugin(
 		func(next plugin.Handler) plugin.Handler {
 			netboxdns.Next = next
@@ -118,6 +118,823 @@ var setupTests []SetupTest = []SetupTest{
 		}`,
 		true,
 	},
+	{
+		"minimum configuration with query_timeout",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			query_timeout 2s
+		}`,
+		false,
+	},
+	{
+		"invalid query_timeout",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			query_timeout 2x
+		}`,
+		true,
+	},
+	{
+		"non-positive query_timeout",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			query_timeout 0s
+		}`,
+		true,
+	},
+	{
+		"minimum configuration with retry",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry
+		}`,
+		false,
+	},
+	{
+		"retry with attempts and backoff",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry 5 200ms 10s
+		}`,
+		false,
+	},
+	{
+		"invalid retry attempts",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry many
+		}`,
+		true,
+	},
+	{
+		"non-positive retry attempts",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry 0
+		}`,
+		true,
+	},
+	{
+		"invalid retry backoff",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry 3 1x
+		}`,
+		true,
+	},
+	{
+		"retry backoff exceeding maximum",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry 3 5s 1s
+		}`,
+		true,
+	},
+	{
+		"too many retry arguments",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			retry 3 1s 2s 3s
+		}`,
+		true,
+	},
+	{
+		"minimum configuration with circuit_breaker",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			circuit_breaker
+		}`,
+		false,
+	},
+	{
+		"circuit_breaker with failures and cooldown",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			circuit_breaker 10 1m
+		}`,
+		false,
+	},
+	{
+		"invalid circuit_breaker failures",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			circuit_breaker -1
+		}`,
+		true,
+	},
+	{
+		"invalid circuit_breaker cooldown",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			circuit_breaker 5 soon
+		}`,
+		true,
+	},
+	{
+		"too many circuit_breaker arguments",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			circuit_breaker 5 1m 2m
+		}`,
+		true,
+	},
+	{
+		"minimum configuration with refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 30s
+		}`,
+		false,
+	},
+	{
+		"no value for refresh specified",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh
+		}`,
+		true,
+	},
+	{
+		"invalid refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 0s
+		}`,
+		true,
+	},
+	{
+		"refresh with changelog",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 10s
+			changelog
+		}`,
+		false,
+	},
+	{
+		"refresh with changelog resync interval",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 10s
+			changelog 6h
+		}`,
+		false,
+	},
+	{
+		"changelog without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			changelog
+		}`,
+		true,
+	},
+	{
+		"invalid changelog resync interval",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 10s
+			changelog 6x
+		}`,
+		true,
+	},
+	{
+		"refresh with webhook",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			webhook :8053 mysecret
+		}`,
+		false,
+	},
+	{
+		"webhook without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			webhook :8053 mysecret
+		}`,
+		true,
+	},
+	{
+		"webhook without secret",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			webhook :8053
+		}`,
+		true,
+	},
+	{
+		"invalid webhook address",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			webhook localhost mysecret
+		}`,
+		true,
+	},
+	{
+		"refresh with ixfr",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ixfr
+		}`,
+		false,
+	},
+	{
+		"refresh with ixfr journal size",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ixfr 50
+		}`,
+		false,
+	},
+	{
+		"ixfr without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			ixfr
+		}`,
+		true,
+	},
+	{
+		"invalid ixfr journal size",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ixfr 0
+		}`,
+		true,
+	},
+	{
+		"dnssec with ksk and zsk",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			dnssec example.com .testing/dnssec/Kexample.com.+013+13083 .testing/dnssec/Kexample.com.+013+03148
+		}`,
+		false,
+	},
+	{
+		"dnssec without key",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			dnssec example.com
+		}`,
+		true,
+	},
+	{
+		"dnssec missing key file",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			dnssec example.com .testing/dnssec/Kexample.com.+013+00000
+		}`,
+		true,
+	},
+	{
+		"dnssec key for other zone",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			dnssec example.net .testing/dnssec/Kexample.com.+013+13083
+		}`,
+		true,
+	},
+	{
+		"synthesize ptr",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			synthesize_ptr
+		}`,
+		false,
+	},
+	{
+		"synthesize ptr with argument",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			synthesize_ptr yes
+		}`,
+		true,
+	},
+	{
+		"ipam in server zones",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ipam
+		}`,
+		false,
+	},
+	{
+		"ipam with zones and precedence",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ipam_precedence ipam
+			ipam example.com 10.in-addr.arpa
+		}`,
+		false,
+	},
+	{
+		"ipam without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			ipam example.com
+		}`,
+		true,
+	},
+	{
+		"ipam precedence without ipam",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ipam_precedence records
+		}`,
+		true,
+	},
+	{
+		"invalid ipam precedence",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			ipam example.com
+			ipam_precedence dns
+		}`,
+		true,
+	},
+	{
+		"devices and virtual machines",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices example.com site=main role=server tag=dns
+			virtual_machines vm.example.com {{.Name}}.{{.Cluster.Slug}} tenant=ops
+		}`,
+		false,
+	},
+	{
+		"devices without zone",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices
+		}`,
+		true,
+	},
+	{
+		"devices without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			devices example.com
+		}`,
+		true,
+	},
+	{
+		"devices invalid template",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices example.com {{.Name
+		}`,
+		true,
+	},
+	{
+		"devices two templates",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices example.com {{.Name}} {{.ID}}
+		}`,
+		true,
+	},
+	{
+		"services",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices example.com
+			services example.com "Web Server=http" ldaps=_ldap
+		}`,
+		false,
+	},
+	{
+		"services without hosts",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			services example.com
+		}`,
+		true,
+	},
+	{
+		"services invalid label mapping",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			devices example.com
+			services example.com http
+		}`,
+		true,
+	},
+	{
+		"ecs without trusted resolvers",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			ecs
+		}`,
+		true,
+	},
+	{
+		"ecs from trusted resolvers",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			ecs 10.0.0.0/8 2001:db8::/32
+		}`,
+		false,
+	},
+	{
+		"ecs invalid prefix",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			ecs 10.0.0.1
+		}`,
+		true,
+	},
+	{
+		"view by tsig key and listener",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			view_tsig internal.key. internal
+			view_listen 192.0.2.53 external
+			view_listen [2001:db8::53]:5353 external
+			view_listen :5300 internal
+		}`,
+		false,
+	},
+	{
+		"view_tsig without view",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			view_tsig internal.key.
+		}`,
+		true,
+	},
+	{
+		"view_listen invalid address",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			view_listen localhost:53 internal
+		}`,
+		true,
+	},
+	{
+		"view order and fallback view",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			view_order internal external
+			fallback_view external
+		}`,
+		false,
+	},
+	{
+		"view_order without views",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			view_order
+		}`,
+		true,
+	},
+	{
+		"fallback_view with two views",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			fallback_view internal external
+		}`,
+		true,
+	},
+	{
+		"zone filters",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tenant unit-a unit-b
+			tag dns-public
+			zone_filter cf_environment=production view=external
+		}`,
+		false,
+	},
+	{
+		"tenant without tenants",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tenant
+		}`,
+		true,
+	},
+	{
+		"tag without tags",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tag
+		}`,
+		true,
+	},
+	{
+		"invalid zone filter",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			zone_filter production
+		}`,
+		true,
+	},
+	{
+		"statuses",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			zone_status active dynamic reserved
+			record_status active
+			parked 192.0.2.80 2001:db8::80
+		}`,
+		false,
+	},
+	{
+		"invalid zone status",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			zone_status enabled
+		}`,
+		true,
+	},
+	{
+		"invalid record status",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			record_status parked
+		}`,
+		true,
+	},
+	{
+		"parked without addresses",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			parked
+		}`,
+		true,
+	},
+	{
+		"parked with invalid address",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			parked parked.example.com
+		}`,
+		true,
+	},
+	{
+		"acl",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			acl mgmt.example.com allow 10.0.0.0/8
+			acl mgmt.example.com refuse 0.0.0.0/0 ::/0
+			acl_tag internal deny 0.0.0.0/0
+			acl_field dns_acl
+		}`,
+		false,
+	},
+	{
+		"acl with invalid action",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			acl mgmt.example.com permit 10.0.0.0/8
+		}`,
+		true,
+	},
+	{
+		"acl with invalid network",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			acl mgmt.example.com allow 10.0.0.0/33
+		}`,
+		true,
+	},
+	{
+		"acl without network",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			acl_tag internal allow
+		}`,
+		true,
+	},
+	{
+		"acl_field without field",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			acl_field
+		}`,
+		true,
+	},
+	{
+		"tsig key",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_key transfer.key. c2VjcmV0
+			tsig_acl example.com transfer transfer.key.
+		}`,
+		false,
+	},
+	{
+		"tsig key from file",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_key transfer.key. file testdata/tsig.key
+		}`,
+		false,
+	},
+	{
+		"tsig key with invalid secret",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_key transfer.key. not-base64!
+		}`,
+		true,
+	},
+	{
+		"tsig key with missing file",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_key transfer.key. file testdata/missing.key
+		}`,
+		true,
+	},
+	{
+		"tsig acl with invalid operation",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_key transfer.key. c2VjcmV0
+			tsig_acl example.com notify transfer.key.
+		}`,
+		true,
+	},
+	{
+		"tsig acl without keys",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_acl example.com transfer
+		}`,
+		true,
+	},
+	{
+		"tsig acl with undefined key",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			tsig_acl example.com update update.key.
+		}`,
+		true,
+	},
+	{
+		"update all zones",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			update
+		}`,
+		false,
+	},
+	{
+		"update some zones",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			update example.com dyn.example.net
+		}`,
+		false,
+	},
+	{
+		"notify name servers",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			notify example.com
+		}`,
+		false,
+	},
+	{
+		"notify secondaries",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			notify example.com 192.0.2.1 [2001:db8::1]:5353
+			notify example.net 192.0.2.2
+		}`,
+		false,
+	},
+	{
+		"notify without zone",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			notify
+		}`,
+		true,
+	},
+	{
+		"notify invalid secondary",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			refresh 1m
+			notify example.com not/an/address
+		}`,
+		true,
+	},
+	{
+		"notify without refresh",
+		`netboxdns {
+			token sometoken
+			url http://localhost:9999/
+			notify example.com
+		}`,
+		true,
+	},
 	{
 		"minimum configuration fallthrough all zones",
 		`netboxdns {
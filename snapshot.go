@@ -0,0 +1,576 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// snapshot is an indexed in-memory copy of the zones, views and records held
+// in Netbox. It is safe for concurrent use.
+type snapshot struct {
+	mu sync.RWMutex
+
+	loaded  time.Time
+	zones   map[int]netbox.Zone
+	views   map[int]netbox.View
+	records map[int]netbox.Record
+
+	// indexes into records by record ID
+	byFQDN  map[string][]int
+	byValue map[string][]int
+	byZone  map[int][]int
+
+	// dirty holds the IDs of zones whose records changed since the last call
+	// to takeDirtyZones
+	dirty map[int]struct{}
+	// generation is increased with every change
+	generation uint64
+	// derived caches data built from the records of zones, e.g. their names,
+	// by zone ID and kind until the zone changes
+	derived map[int]map[string]cachedValue
+}
+
+// cachedValue is data derived from a zone, built when the source snapshots
+// were at the given generation
+type cachedValue struct {
+	value   any
+	sources uint64
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{}
+}
+
+// ready reports whether the snapshot has been loaded at least once
+func (snap *snapshot) ready() bool {
+	if snap == nil {
+		return false
+	}
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	return !snap.loaded.IsZero()
+}
+
+// age returns the time since the snapshot was last fully loaded
+func (snap *snapshot) age() time.Duration {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	return time.Since(snap.loaded)
+}
+
+// set replaces the entire contents of the snapshot
+func (snap *snapshot) set(
+	zones []netbox.Zone,
+	views []netbox.View,
+	records []netbox.Record,
+) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.dirty == nil {
+		snap.dirty = make(map[int]struct{}, len(zones))
+	}
+	for id := range snap.zones {
+		snap.dirty[id] = struct{}{}
+	}
+	for _, zone := range zones {
+		snap.dirty[zone.ID] = struct{}{}
+	}
+	snap.generation++
+	snap.derived = nil
+	snap.zones = make(map[int]netbox.Zone, len(zones))
+	for _, zone := range zones {
+		snap.zones[zone.ID] = zone
+	}
+	snap.views = make(map[int]netbox.View, len(views))
+	for _, view := range views {
+		snap.views[view.ID] = view
+	}
+	snap.records = make(map[int]netbox.Record, len(records))
+	snap.byFQDN = make(map[string][]int)
+	snap.byValue = make(map[string][]int)
+	snap.byZone = make(map[int][]int, len(zones))
+	for _, record := range records {
+		// records of zones that are not served are returned by Netbox
+		// since the records endpoint cannot filter by zone
+		if _, ok := snap.zones[record.Zone.ID]; ok {
+			snap.indexRecord(record)
+		}
+	}
+	snap.loaded = time.Now()
+}
+
+// indexRecord adds record to the snapshot. The write lock must be held.
+func (snap *snapshot) indexRecord(record netbox.Record) {
+	snap.markDirty(record.Zone.ID)
+	snap.records[record.ID] = record
+	key := fqdnKey(record.FQDN)
+	snap.byFQDN[key] = append(snap.byFQDN[key], record.ID)
+	value := valueKey(record.Value)
+	snap.byValue[value] = append(snap.byValue[value], record.ID)
+	snap.byZone[record.Zone.ID] = append(snap.byZone[record.Zone.ID], record.ID)
+}
+
+// unindexRecord removes the record with the given ID from the snapshot. The
+// write lock must be held.
+func (snap *snapshot) unindexRecord(id int) {
+	record, ok := snap.records[id]
+	if !ok {
+		return
+	}
+	snap.markDirty(record.Zone.ID)
+	delete(snap.records, id)
+	key := fqdnKey(record.FQDN)
+	if ids := removeID(snap.byFQDN[key], id); len(ids) > 0 {
+		snap.byFQDN[key] = ids
+	} else {
+		delete(snap.byFQDN, key)
+	}
+	value := valueKey(record.Value)
+	if ids := removeID(snap.byValue[value], id); len(ids) > 0 {
+		snap.byValue[value] = ids
+	} else {
+		delete(snap.byValue, value)
+	}
+	if ids := removeID(snap.byZone[record.Zone.ID], id); len(ids) > 0 {
+		snap.byZone[record.Zone.ID] = ids
+	} else {
+		delete(snap.byZone, record.Zone.ID)
+	}
+}
+
+// markDirty records a change to the zone with the given ID. The write lock
+// must be held.
+func (snap *snapshot) markDirty(id int) {
+	if snap.dirty == nil {
+		snap.dirty = make(map[int]struct{})
+	}
+	snap.dirty[id] = struct{}{}
+	snap.generation++
+	delete(snap.derived, id)
+}
+
+// version returns the generation of the snapshot, which changes with its
+// contents
+func (snap *snapshot) version() uint64 {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	return snap.generation
+}
+
+// cachedZoneValue returns the data of the given kind derived from the zone
+// with the given ID if it was cached since the zone last changed and the
+// source snapshots are still at the generation sources
+func (snap *snapshot) cachedZoneValue(id int, kind string, sources uint64) (any, bool) {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	cached, ok := snap.derived[id][kind]
+	if !ok || cached.sources != sources {
+		return nil, false
+	}
+	return cached.value, true
+}
+
+// cacheZoneValue caches data of the given kind derived from the zone with the
+// given ID at generation. Data built from an older generation is dropped.
+func (snap *snapshot) cacheZoneValue(
+	id int,
+	kind string,
+	value any,
+	generation uint64,
+	sources uint64,
+) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.generation != generation {
+		return
+	}
+	if snap.derived == nil {
+		snap.derived = make(map[int]map[string]cachedValue)
+	}
+	if snap.derived[id] == nil {
+		snap.derived[id] = make(map[string]cachedValue)
+	}
+	snap.derived[id][kind] = cachedValue{value: value, sources: sources}
+}
+
+// zoneCached returns the data of the given kind derived from zone, which is
+// built by build and cached in the snapshot until the zone changes
+func zoneCached[T any](
+	netboxdns *NetboxDNS,
+	zone *netbox.Zone,
+	kind string,
+	build func() (T, error),
+) (T, error) {
+	var sources uint64
+	for _, source := range netboxdns.sourceSnapshots() {
+		sources += source.version()
+	}
+	if value, ok := netboxdns.snapshot.cachedZoneValue(zone.ID, kind, sources); ok {
+		return value.(T), nil
+	}
+	generation := netboxdns.snapshot.version()
+	value, err := build()
+	if err != nil {
+		return value, err
+	}
+	netboxdns.snapshot.cacheZoneValue(zone.ID, kind, value, generation, sources)
+	return value, nil
+}
+
+// takeDirtyZones returns the IDs of zones changed since the last call
+func (snap *snapshot) takeDirtyZones() []int {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	out := make([]int, 0, len(snap.dirty))
+	for id := range snap.dirty {
+		out = append(out, id)
+	}
+	snap.dirty = nil
+	sort.Ints(out)
+	return out
+}
+
+// getZone returns the zone with the given ID
+func (snap *snapshot) getZone(id int) (netbox.Zone, bool) {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	zone, ok := snap.zones[id]
+	return zone, ok
+}
+
+func removeID(ids []int, id int) []int {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// putRecord adds or updates record. Records of zones not in the snapshot are
+// removed instead, as the zone is not served.
+func (snap *snapshot) putRecord(record netbox.Record) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.unindexRecord(record.ID)
+	if _, ok := snap.zones[record.Zone.ID]; ok {
+		snap.indexRecord(record)
+	}
+}
+
+func (snap *snapshot) deleteRecord(id int) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.unindexRecord(id)
+}
+
+// putZone adds or updates zone. It returns the previous version of the zone
+// and whether one existed.
+func (snap *snapshot) putZone(zone netbox.Zone) (netbox.Zone, bool) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	previous, ok := snap.zones[zone.ID]
+	snap.zones[zone.ID] = zone
+	snap.markDirty(zone.ID)
+	return previous, ok
+}
+
+// deleteZone removes the zone with the given ID and all of its records
+func (snap *snapshot) deleteZone(id int) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	delete(snap.zones, id)
+	snap.markDirty(id)
+	for _, recordID := range append([]int(nil), snap.byZone[id]...) {
+		snap.unindexRecord(recordID)
+	}
+}
+
+// setZoneRecords replaces all records of the zone with the given ID
+func (snap *snapshot) setZoneRecords(id int, records []netbox.Record) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	for _, recordID := range append([]int(nil), snap.byZone[id]...) {
+		snap.unindexRecord(recordID)
+	}
+	for _, record := range records {
+		snap.indexRecord(record)
+	}
+}
+
+func (snap *snapshot) putView(view netbox.View) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.views[view.ID] = view
+}
+
+func (snap *snapshot) deleteView(id int) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	delete(snap.views, id)
+}
+
+func (snap *snapshot) getZones() []netbox.Zone {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	out := make([]netbox.Zone, 0, len(snap.zones))
+	for _, zone := range snap.zones {
+		out = append(out, zone)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (snap *snapshot) getView(id int) (netbox.View, bool) {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+	view, ok := snap.views[id]
+	return view, ok
+}
+
+// getRecords returns copies of the records matching query, applying the same
+// filter semantics as the Netbox records endpoint.
+func (snap *snapshot) getRecords(query *netbox.RecordQuery) []netbox.Record {
+	snap.mu.RLock()
+	defer snap.mu.RUnlock()
+
+	var candidates []int
+	switch {
+	case query.FQDN != "":
+		candidates = snap.byFQDN[fqdnKey(query.FQDN)]
+	case query.Value != "":
+		candidates = snap.byValue[valueKey(query.Value)]
+	case query.Zone != nil:
+		candidates = snap.byZone[query.Zone.ID]
+	default:
+		candidates = make([]int, 0, len(snap.records))
+		for id := range snap.records {
+			candidates = append(candidates, id)
+		}
+	}
+
+	out := make([]netbox.Record, 0, len(candidates))
+	for _, id := range candidates {
+		record := snap.records[id]
+		if !recordMatches(record, query) {
+			continue
+		}
+		if zone, ok := snap.zones[record.Zone.ID]; ok {
+			// records hold a reference to their zone, which lacks fields
+			// like the tenant and may be outdated
+			record.Zone = zone
+			if record.TTL == nil {
+				ttl := zone.DefaultTTL
+				record.TTL = &ttl
+			}
+		}
+		out = append(out, record)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func recordMatches(record netbox.Record, query *netbox.RecordQuery) bool {
+	if query.FQDN != "" && fqdnKey(record.FQDN) != fqdnKey(query.FQDN) {
+		return false
+	}
+	if query.Name != "" && record.Name != query.Name {
+		return false
+	}
+	if query.Value != "" && valueKey(record.Value) != valueKey(query.Value) {
+		return false
+	}
+	if query.Zone != nil && record.Zone.ID != query.Zone.ID {
+		return false
+	}
+	if len(query.Type) == 0 {
+		return true
+	}
+	for _, t := range query.Type {
+		if strings.EqualFold(record.Type, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// fqdnKey normalises a name for use as an index key
+func fqdnKey(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+// valueKey normalises a record value for use as an index key. Addresses are
+// brought into their canonical form so that differently written IPv6
+// addresses match.
+func valueKey(value string) string {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().String()
+	}
+	return strings.ToLower(value)
+}
+
+// loadSnapshot fetches all zones, views and records from Netbox
+func (netboxdns *NetboxDNS) loadSnapshot(ctx context.Context) error {
+	zones, err := netbox.GetZones(ctx, netboxdns.requestClient, netboxdns.zoneQuery())
+	if err != nil {
+		return err
+	}
+	views, err := netbox.GetViews(ctx, netboxdns.requestClient)
+	if err != nil {
+		return err
+	}
+	records, err := netbox.GetRecordsUnresolved(
+		ctx,
+		netboxdns.requestClient,
+		netboxdns.servedQuery(&netbox.RecordQuery{}),
+	)
+	if err != nil {
+		return err
+	}
+	netboxdns.snapshot.set(zones, views, records)
+	logger.Infof(
+		"loaded snapshot of %d zones, %d views and %d records",
+		len(zones),
+		len(views),
+		len(records),
+	)
+	return nil
+}
+
+// startRefresh loads the initial snapshot and refreshes it in the background
+// every refresh interval until stopRefresh is called.
+func (netboxdns *NetboxDNS) startRefresh() error {
+	ctx := netboxdns.backgroundContext()
+	netboxdns.stopRefreshCh = make(chan struct{})
+	if err := netboxdns.syncSnapshot(ctx); err != nil {
+		logger.Errorf(
+			"could not load initial snapshot; querying Netbox directly until a refresh succeeds: %v",
+			err,
+		)
+	}
+	netboxdns.refreshSources(ctx)
+	netboxdns.trackChanges(ctx)
+	go func() {
+		ticker := time.NewTicker(netboxdns.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-netboxdns.stopRefreshCh:
+				return
+			case <-ticker.C:
+				err := netboxdns.syncSnapshot(ctx)
+				netboxdns.refreshSources(ctx)
+				netboxdns.trackChanges(ctx)
+				if err != nil {
+					if netboxdns.snapshot.ready() {
+						logger.Errorf(
+							"could not refresh snapshot; serving snapshot from %s ago: %v",
+							netboxdns.snapshot.age().Round(time.Second),
+							err,
+						)
+					} else {
+						logger.Errorf("could not load snapshot: %v", err)
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (netboxdns *NetboxDNS) stopRefresh() error {
+	if netboxdns.stopRefreshCh != nil {
+		close(netboxdns.stopRefreshCh)
+		netboxdns.stopRefreshCh = nil
+	}
+	return nil
+}
+
+// getZones returns all served zones from the snapshot if one is loaded,
+// otherwise from the Netbox API
+func (netboxdns *NetboxDNS) getZones(ctx context.Context) ([]netbox.Zone, error) {
+	if netboxdns.snapshot.ready() {
+		snapshotLookups.WithLabelValues("hit").Inc()
+		return netboxdns.filterZones(netboxdns.snapshot.getZones()), nil
+	}
+	snapshotLookups.WithLabelValues("miss").Inc()
+	return netboxdns.apiZones(ctx)
+}
+
+// apiZones returns all served zones from the Netbox API. They are requested
+// once per query if ctx is the context of one.
+func (netboxdns *NetboxDNS) apiZones(ctx context.Context) ([]netbox.Zone, error) {
+	cache, ok := ctx.Value(queryCacheKey{}).(*queryCache)
+	if !ok {
+		return netboxdns.fetchZones(ctx)
+	}
+	cache.zonesOnce.Do(func() {
+		cache.zones, cache.zonesErr = netboxdns.fetchZones(ctx)
+	})
+	return cache.zones, cache.zonesErr
+}
+
+func (netboxdns *NetboxDNS) fetchZones(ctx context.Context) ([]netbox.Zone, error) {
+	zones, err := netbox.GetZones(ctx, netboxdns.requestClient, netboxdns.zoneQuery())
+	if err != nil {
+		return nil, err
+	}
+	return netboxdns.filterZones(zones), nil
+}
+
+// queryCache holds what is fetched from the Netbox API for a query without a
+// snapshot, so that it is requested once per query
+type queryCache struct {
+	zonesOnce sync.Once
+	zones     []netbox.Zone
+	zonesErr  error
+
+	mu sync.Mutex
+	// names are the names of zones by zone ID
+	names map[int]map[string]bool
+}
+
+type queryCacheKey struct{}
+
+// getView returns the view with the given ID from the snapshot if one is
+// loaded, otherwise from the Netbox API
+func (netboxdns *NetboxDNS) getView(ctx context.Context, id int) (netbox.View, error) {
+	if netboxdns.snapshot.ready() {
+		if view, ok := netboxdns.snapshot.getView(id); ok {
+			return view, nil
+		}
+	}
+	return netbox.GetView(ctx, netboxdns.requestClient, id)
+}
+
+// getRecords returns the served records matching query from the snapshot if
+// one is loaded, otherwise from the Netbox API
+func (netboxdns *NetboxDNS) getRecords(
+	ctx context.Context,
+	query *netbox.RecordQuery,
+) ([]netbox.Record, error) {
+	if netboxdns.snapshot.ready() {
+		snapshotLookups.WithLabelValues("hit").Inc()
+		records := netboxdns.filterRecords(netboxdns.snapshot.getRecords(query))
+		return netboxdns.mergeSources(query, records), nil
+	}
+	snapshotLookups.WithLabelValues("miss").Inc()
+	zones, err := netboxdns.apiZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	servedQuery := netboxdns.servedQuery(query)
+	servedQuery.Zones = zones
+	records, err := netbox.GetRecordsQuery(ctx, netboxdns.requestClient, servedQuery)
+	if err != nil {
+		return nil, err
+	}
+	return netboxdns.mergeSources(query, netboxdns.filterRecords(records)), nil
+}
@@ -0,0 +1,145 @@
+package netboxdns
+
+import (
+	"testing"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+func testSnapshot() *snapshot {
+	ttl := uint32(300)
+	zones := []netbox.Zone{
+		{ID: 1, Name: "example.com", DefaultTTL: 3600},
+		{ID: 2, Name: "sub.example.com", DefaultTTL: 1800},
+	}
+	zones[0].View.ID = 1
+	zones[1].View.ID = 1
+	views := []netbox.View{{ID: 1, Name: "default", Default: true}}
+	records := []netbox.Record{
+		{ID: 1, Name: "@", Type: "SOA", Value: "dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600", FQDN: "example.com.", Zone: zones[0]},
+		{ID: 2, Name: "web", Type: "A", Value: "10.0.0.17", FQDN: "web.example.com.", Zone: zones[0]},
+		{ID: 3, Name: "web", Type: "AAAA", Value: "2001:db8::17", FQDN: "web.example.com.", Zone: zones[0], TTL: &ttl},
+		{ID: 4, Name: "www", Type: "CNAME", Value: "web", FQDN: "www.example.com.", Zone: zones[0]},
+		{ID: 5, Name: "host", Type: "A", Value: "10.0.1.10", FQDN: "host.sub.example.com.", Zone: zones[1]},
+	}
+	snap := newSnapshot()
+	snap.set(zones, views, records)
+	return snap
+}
+
+func TestSnapshotReady(t *testing.T) {
+	var nilSnap *snapshot
+	if nilSnap.ready() {
+		t.Error("nil snapshot reported ready")
+	}
+	if newSnapshot().ready() {
+		t.Error("empty snapshot reported ready")
+	}
+	if !testSnapshot().ready() {
+		t.Error("loaded snapshot not reported ready")
+	}
+}
+
+func TestSnapshotGetRecords(t *testing.T) {
+	snap := testSnapshot()
+	zones := snap.getZones()
+	tests := []struct {
+		name  string
+		query *netbox.RecordQuery
+		want  []int
+	}{
+		{"fqdn without trailing dot", &netbox.RecordQuery{FQDN: "web.example.com"}, []int{2, 3}},
+		{"fqdn mixed case", &netbox.RecordQuery{FQDN: "WEB.example.com."}, []int{2, 3}},
+		{"fqdn and type", &netbox.RecordQuery{FQDN: "web.example.com", Type: []string{"AAAA"}}, []int{3}},
+		{"multiple types", &netbox.RecordQuery{FQDN: "www.example.com", Type: []string{"A", "CNAME"}}, []int{4}},
+		{"name and zone", &netbox.RecordQuery{Name: "@", Type: []string{"SOA", "NS"}, Zone: &zones[0]}, []int{1}},
+		{"zone only", &netbox.RecordQuery{Zone: &zones[1]}, []int{5}},
+		{"fqdn in other zone", &netbox.RecordQuery{FQDN: "host.sub.example.com", Zone: &zones[0]}, nil},
+		{"unknown fqdn", &netbox.RecordQuery{FQDN: "noop.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snap.getRecords(tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d records, want %d", len(got), len(tt.want))
+			}
+			for i, record := range got {
+				if record.ID != tt.want[i] {
+					t.Errorf("record %d: got ID %d, want %d", i, record.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotResolvesTTL(t *testing.T) {
+	snap := testSnapshot()
+	for _, tt := range []struct {
+		fqdn string
+		want uint32
+	}{
+		{"www.example.com", 3600},
+		{"host.sub.example.com", 1800},
+	} {
+		records := snap.getRecords(&netbox.RecordQuery{FQDN: tt.fqdn})
+		if len(records) != 1 || records[0].TTL == nil {
+			t.Fatalf("%s: expected a single record with a TTL", tt.fqdn)
+		}
+		if *records[0].TTL != tt.want {
+			t.Errorf("%s: got TTL %d, want %d", tt.fqdn, *records[0].TTL, tt.want)
+		}
+	}
+	aaaa := snap.getRecords(&netbox.RecordQuery{FQDN: "web.example.com", Type: []string{"AAAA"}})
+	if *aaaa[0].TTL != 300 {
+		t.Errorf("explicit TTL overwritten: got %d", *aaaa[0].TTL)
+	}
+}
+
+func TestSnapshotRecordsAreCopies(t *testing.T) {
+	snap := testSnapshot()
+	records := snap.getRecords(&netbox.RecordQuery{FQDN: "www.example.com"})
+	records[0].Value = "changed.example.com."
+	again := snap.getRecords(&netbox.RecordQuery{FQDN: "www.example.com"})
+	if again[0].Value != "web" {
+		t.Errorf("snapshot record modified through returned slice: %q", again[0].Value)
+	}
+}
+
+func TestSnapshotIncrementalUpdates(t *testing.T) {
+	snap := testSnapshot()
+	zones := snap.getZones()
+
+	snap.putRecord(netbox.Record{ID: 2, Name: "web2", Type: "A", Value: "10.0.0.18", FQDN: "web2.example.com.", Zone: zones[0]})
+	if got := snap.getRecords(&netbox.RecordQuery{FQDN: "web.example.com", Type: []string{"A"}}); len(got) != 0 {
+		t.Errorf("updated record still indexed under old name: %v", got)
+	}
+	if got := snap.getRecords(&netbox.RecordQuery{FQDN: "web2.example.com"}); len(got) != 1 || got[0].Value != "10.0.0.18" {
+		t.Errorf("updated record not indexed under new name: %v", got)
+	}
+
+	snap.deleteRecord(3)
+	if got := snap.getRecords(&netbox.RecordQuery{FQDN: "web.example.com"}); len(got) != 0 {
+		t.Errorf("deleted record still returned: %v", got)
+	}
+
+	renamed := zones[1]
+	renamed.Name = "other.example.com"
+	snap.putZone(renamed)
+	snap.setZoneRecords(renamed.ID, []netbox.Record{
+		{ID: 5, Name: "host", Type: "A", Value: "10.0.1.10", FQDN: "host.other.example.com.", Zone: renamed},
+	})
+	if got := snap.getRecords(&netbox.RecordQuery{FQDN: "host.sub.example.com"}); len(got) != 0 {
+		t.Errorf("record of renamed zone still returned under old name: %v", got)
+	}
+	if got := snap.getRecords(&netbox.RecordQuery{FQDN: "host.other.example.com"}); len(got) != 1 {
+		t.Errorf("record of renamed zone not returned under new name: %v", got)
+	}
+
+	snap.deleteZone(zones[0].ID)
+	if got := snap.getRecords(&netbox.RecordQuery{Zone: &zones[0]}); len(got) != 0 {
+		t.Errorf("records of deleted zone still returned: %v", got)
+	}
+	if got := snap.getZones(); len(got) != 1 {
+		t.Errorf("got %d zones after delete, want 1", len(got))
+	}
+}
@@ -0,0 +1,111 @@
+package netboxdns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+// refreshSources reloads the records created from IPAM addresses, devices,
+// virtual machines and services, keeping the previous records of a source if
+// Netbox cannot be reached
+func (netboxdns *NetboxDNS) refreshSources(ctx context.Context) {
+	if netboxdns.ipam != nil {
+		if err := netboxdns.syncIPAM(ctx); err != nil {
+			logger.Errorf("could not load IPAM addresses: %v", err)
+		}
+	}
+	for _, source := range netboxdns.hosts {
+		if err := netboxdns.syncHosts(ctx, source); err != nil {
+			logger.Errorf("could not load %s: %v", source.kind, err)
+		}
+	}
+	// service targets are the names given to hosts above
+	for _, source := range netboxdns.services {
+		if err := netboxdns.syncServices(ctx, source); err != nil {
+			logger.Errorf("could not load services: %v", err)
+		}
+	}
+}
+
+// sourceSnapshots returns the snapshots holding the records of all sources
+func (netboxdns *NetboxDNS) sourceSnapshots() []*snapshot {
+	var out []*snapshot
+	if netboxdns.ipam != nil {
+		out = append(out, netboxdns.ipam.records)
+	}
+	for _, source := range netboxdns.hosts {
+		out = append(out, source.records)
+	}
+	for _, source := range netboxdns.services {
+		out = append(out, source.records)
+	}
+	return out
+}
+
+// mergeSources adds the records of all sources matching query to records.
+// Records of devices, virtual machines and services never replace records in
+// Netbox.
+func (netboxdns *NetboxDNS) mergeSources(
+	query *netbox.RecordQuery,
+	records []netbox.Record,
+) []netbox.Record {
+	records = netboxdns.mergeIPAM(query, records)
+	for _, source := range netboxdns.hosts {
+		if !source.records.ready() {
+			continue
+		}
+		records = mergeRecords(records, source.records.getRecords(query))
+	}
+	for _, source := range netboxdns.services {
+		if !source.records.ready() {
+			continue
+		}
+		records = mergeRecords(records, source.records.getRecords(query))
+	}
+	return records
+}
+
+// mergeRecords returns kept and the records of extra that do not have the
+// same name and type as a record of kept in the same zone
+func mergeRecords(kept []netbox.Record, extra []netbox.Record) []netbox.Record {
+	if len(extra) == 0 {
+		return kept
+	}
+	key := func(record netbox.Record) string {
+		return fmt.Sprintf(
+			"%d/%s/%s",
+			record.Zone.ID,
+			fqdnKey(record.FQDN),
+			strings.ToUpper(record.Type),
+		)
+	}
+	shadowed := make(map[string]bool, len(kept))
+	for _, record := range kept {
+		shadowed[key(record)] = true
+	}
+	out := slices.Clone(kept)
+	for _, record := range extra {
+		if !shadowed[key(record)] {
+			out = append(out, record)
+		}
+	}
+	return out
+}
+
+// setSourceRecords replaces the records of a source. Only the zones holding
+// records are kept, so that reloads mark only those as changed.
+func setSourceRecords(snap *snapshot, records []netbox.Record) {
+	used := make(map[int]netbox.Zone)
+	for _, record := range records {
+		used[record.Zone.ID] = record.Zone
+	}
+	zones := make([]netbox.Zone, 0, len(used))
+	for _, zone := range used {
+		zones = append(zones, zone)
+	}
+	snap.set(zones, nil, records)
+}
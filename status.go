@@ -0,0 +1,130 @@
+package netboxdns
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// defaultZoneStatus and defaultRecordStatus are the statuses Netbox considers
+// active
+var (
+	defaultZoneStatus   = []string{netbox.ZoneStatusActive, netbox.ZoneStatusDynamic}
+	defaultRecordStatus = []string{netbox.RecordStatusActive}
+)
+
+// servesStatus reports whether objects with status are served. Objects
+// without a status, e.g. from older versions of netbox-plugin-dns, and
+// objects of any status if statuses is empty are served.
+func servesStatus(statuses []string, status string) bool {
+	return len(statuses) == 0 || status == "" || slices.Contains(statuses, status)
+}
+
+func (netboxdns *NetboxDNS) servesZone(zone netbox.Zone) bool {
+	return netboxdns.zoneQuery().Matches(zone)
+}
+
+func (netboxdns *NetboxDNS) servesRecord(record netbox.Record) bool {
+	return servesStatus(netboxdns.recordStatus, record.Status) &&
+		netboxdns.servesZone(record.Zone)
+}
+
+// zoneServed reports whether zone passes the zone filter. Netbox is asked for
+// the zone if the filter has query parameters, which only Netbox applies.
+func (netboxdns *NetboxDNS) zoneServed(ctx context.Context, zone netbox.Zone) (bool, error) {
+	if !netboxdns.servesZone(zone) {
+		return false, nil
+	}
+	if len(netboxdns.zoneFilter.Params) == 0 {
+		return true, nil
+	}
+	query := netboxdns.zoneQuery()
+	query.Params = maps.Clone(query.Params)
+	query.Params.Set("id", strconv.Itoa(zone.ID))
+	zones, err := netbox.GetZones(ctx, netboxdns.requestClient, query)
+	if err != nil {
+		return false, err
+	}
+	return len(zones) > 0, nil
+}
+
+// zoneQuery returns the filter of the served zones
+func (netboxdns *NetboxDNS) zoneQuery() *netbox.ZoneQuery {
+	query := netboxdns.zoneFilter
+	query.Status = netboxdns.zoneStatus
+	return &query
+}
+
+// servedQuery returns a copy of query limited to the served record statuses
+func (netboxdns *NetboxDNS) servedQuery(query *netbox.RecordQuery) *netbox.RecordQuery {
+	out := *query
+	out.Status = netboxdns.recordStatus
+	return &out
+}
+
+func (netboxdns *NetboxDNS) filterZones(zones []netbox.Zone) []netbox.Zone {
+	out := zones[:0:0]
+	for _, zone := range zones {
+		if netboxdns.servesZone(zone) {
+			out = append(out, zone)
+		}
+	}
+	return out
+}
+
+func (netboxdns *NetboxDNS) filterRecords(records []netbox.Record) []netbox.Record {
+	out := records[:0:0]
+	for _, record := range records {
+		if netboxdns.servesRecord(record) {
+			out = append(out, record)
+		}
+	}
+	return out
+}
+
+// parkedResponse answers qname in a parked zone. The SOA and NS records of
+// the apex are served, every name in the zone holds the placeholder
+// addresses and has no other data.
+func (netboxdns *NetboxDNS) parkedResponse(
+	ctx context.Context,
+	qname string,
+	qtype uint16,
+	zone *netbox.Zone,
+) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "parkedResponse")
+	defer span.Finish()
+	if qname == zone.Name {
+		origin, err := netboxdns.processOrigin(ctx, qtype, zone)
+		if err != nil || origin != nil {
+			return origin, err
+		}
+	}
+	var answer []dns.RR
+	for _, addr := range netboxdns.parked {
+		header := dns.RR_Header{
+			Name:   dns.Fqdn(qname),
+			Rrtype: qtype,
+			Class:  dns.ClassINET,
+			Ttl:    zone.DefaultTTL,
+		}
+		switch {
+		case qtype == dns.TypeA && addr.Is4():
+			answer = append(answer, &dns.A{Hdr: header, A: addr.AsSlice()})
+		case qtype == dns.TypeAAAA && addr.Is6():
+			answer = append(answer, &dns.AAAA{Hdr: header, AAAA: addr.AsSlice()})
+		}
+	}
+	if len(answer) > 0 {
+		return &lookupResponse{Answer: answer}, nil
+	}
+	response, err := netboxdns.negativeResponse(ctx, qname, zone)
+	if err != nil {
+		return nil, err
+	}
+	response.LookupResult = lookupNoData
+	return response, nil
+}
@@ -0,0 +1,137 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		qname        string
+		qtype        uint16
+		zoneStatus   string
+		recordStatus string
+		parked       []netip.Addr
+		rcode        int
+		answer       []string
+	}{
+		{
+			name:   "active zone and record",
+			qname:  "web.example.com.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"web.example.com. 3600 IN A 10.0.0.17"},
+		},
+		{
+			name:         "inactive record",
+			qname:        "web.example.com.",
+			qtype:        dns.TypeA,
+			recordStatus: netbox.RecordStatusInactive,
+			rcode:        dns.RcodeNameError,
+		},
+		{
+			name:       "deprecated zone",
+			qname:      "web.example.com.",
+			qtype:      dns.TypeA,
+			zoneStatus: netbox.ZoneStatusDeprecated,
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "parked zone without placeholder",
+			qname:      "web.example.com.",
+			qtype:      dns.TypeA,
+			zoneStatus: netbox.ZoneStatusParked,
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "parked zone",
+			qname:      "www.example.com.",
+			qtype:      dns.TypeA,
+			zoneStatus: netbox.ZoneStatusParked,
+			parked:     []netip.Addr{netip.MustParseAddr("192.0.2.80"), netip.MustParseAddr("2001:db8::80")},
+			rcode:      dns.RcodeSuccess,
+			answer:     []string{"www.example.com. 3600 IN A 192.0.2.80"},
+		},
+		{
+			name:       "parked zone without data",
+			qname:      "example.com.",
+			qtype:      dns.TypeMX,
+			zoneStatus: netbox.ZoneStatusParked,
+			parked:     []netip.Addr{netip.MustParseAddr("192.0.2.80")},
+			rcode:      dns.RcodeSuccess,
+		},
+		{
+			name:       "parked zone origin",
+			qname:      "example.com.",
+			qtype:      dns.TypeSOA,
+			zoneStatus: netbox.ZoneStatusParked,
+			parked:     []netip.Addr{netip.MustParseAddr("192.0.2.80")},
+			rcode:      dns.RcodeSuccess,
+			answer:     []string{"example.com. 3600 IN SOA dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t)
+			netboxdns.zoneStatus = defaultZoneStatus
+			netboxdns.recordStatus = defaultRecordStatus
+			netboxdns.parked = tt.parked
+			if len(tt.parked) > 0 {
+				netboxdns.zoneStatus = append(netboxdns.zoneStatus, netbox.ZoneStatusParked)
+			}
+			zone, _ := netboxdns.snapshot.getZone(1)
+			zone.Status = tt.zoneStatus
+			netboxdns.snapshot.putZone(zone)
+			if tt.recordStatus != "" {
+				records := netboxdns.snapshot.getRecords(&netbox.RecordQuery{FQDN: "web.example.com."})
+				for _, record := range records {
+					record.Status = tt.recordStatus
+					netboxdns.snapshot.putRecord(record)
+				}
+			}
+
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, tt.qtype)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if len(rec.Msg.Answer) != len(tt.answer) {
+				t.Fatalf("got answer %v, want %v", rec.Msg.Answer, tt.answer)
+			}
+			for i, want := range tt.answer {
+				rr, err := dns.NewRR(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rec.Msg.Answer[i].String() != rr.String() {
+					t.Errorf("got answer %v, want %v", rec.Msg.Answer[i], rr)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusQuery(t *testing.T) {
+	netboxdns := NewNetboxDNS()
+	query := &netbox.RecordQuery{FQDN: "web.example.com"}
+	if got, want := netboxdns.servedQuery(query).Encode(), "fqdn=web.example.com&status=active"; got != want {
+		t.Errorf("got record query %q, want %q", got, want)
+	}
+	if query.Status != nil {
+		t.Errorf("expected query to be unchanged, got status %v", query.Status)
+	}
+	if got, want := netboxdns.zoneQuery().Encode(), "status=active&status=dynamic"; got != want {
+		t.Errorf("got zone query %q, want %q", got, want)
+	}
+}
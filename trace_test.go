@@ -0,0 +1,124 @@
+package netboxdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTraceLookup(t *testing.T) {
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("servedns")
+	ctx := ot.ContextWithSpan(context.Background(), root)
+
+	netboxdns := newTestPlugin(t)
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(ctx, rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	root.Finish()
+
+	spans := make(map[string]*mocktracer.MockSpan)
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+	parents := map[string]string{
+		"lookup":       "servedns",
+		"matchZone":    "lookup",
+		"lookupDirect": "lookup",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected span %q, got none", name)
+			continue
+		}
+		if span.ParentID != spans[parent].SpanContext.SpanID {
+			t.Errorf("span %q is not a child of %q", name, parent)
+		}
+	}
+}
+
+func TestTraceAPI(t *testing.T) {
+	var traced bool
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		traced = request.Header.Get("Mockpfx-Ids-Traceid") != ""
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{})
+	}))
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("servedns")
+	if _, err := netboxdns.getZones(ot.ContextWithSpan(context.Background(), root)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].OperationName != "netbox GET zones" {
+		t.Fatalf("got spans %v, want one for the zones request", spans)
+	}
+	if spans[0].ParentID != root.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Error("request span is not a child of the request")
+	}
+	if status := spans[0].Tag("http.status_code"); status != uint16(http.StatusOK) {
+		t.Errorf("got status tag %v, want %d", status, http.StatusOK)
+	}
+	if !traced {
+		t.Error("expected the span context in the request headers")
+	}
+}
+
+func TestTraceAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+		Breaker:   &netbox.CircuitBreaker{Threshold: 1, Cooldown: time.Minute},
+	}
+
+	tracer := mocktracer.New()
+	ctx := ot.ContextWithSpan(context.Background(), tracer.StartSpan("servedns"))
+	for range 2 {
+		if _, err := netboxdns.getZones(ctx); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got spans %v, want one for the failed request and the rejected one", spans)
+	}
+	if status := spans[0].Tag("http.status_code"); status != uint16(http.StatusServiceUnavailable) {
+		t.Errorf("got status tag %v, want %d", status, http.StatusServiceUnavailable)
+	}
+	for _, span := range spans {
+		if span.Tag("error") != true {
+			t.Errorf("span %q of a failed request is not marked as an error", span.OperationName)
+		}
+		if len(span.Logs()) == 0 {
+			t.Errorf("span %q does not log the error", span.OperationName)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package netboxdns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// transferBatchSize is the number of records sent to the transfer plugin at a
+// time
+const transferBatchSize int = 500
+
+// transferViews hands the zone selected for a transfer request in ServeDNS
+// to Transfer. The transfer plugin calls Transfer without any information
+// about the requester, so transfers of the same zone name are serialised
+// while the selection is pending.
+//
+// This hands every transfer the zone of its own requester because the lock of
+// a zone name is held from ServeDNS until the next plugin returns, and the
+// transfer plugin calls Transfer synchronously from its ServeDNS, in the
+// goroutine of the request. The zone pending for a name is therefore always
+// the one selected for the request being served. Transfers of the same name
+// from different views wait for each other, while transfers of other names
+// are not affected.
+type transferViews struct {
+	mu      sync.Mutex
+	locks   map[string]*sync.Mutex
+	pending map[string]netbox.Zone
+}
+
+func newTransferViews() *transferViews {
+	return &transferViews{
+		locks:   make(map[string]*sync.Mutex),
+		pending: make(map[string]netbox.Zone),
+	}
+}
+
+// acquire blocks until no other transfer of the zone name is in progress and
+// records zone as the one to transfer. The returned function releases it.
+func (views *transferViews) acquire(zone netbox.Zone) func() {
+	key := fqdnKey(zone.Name)
+	views.mu.Lock()
+	lock, ok := views.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		views.locks[key] = lock
+	}
+	views.mu.Unlock()
+
+	lock.Lock()
+	views.mu.Lock()
+	views.pending[key] = zone
+	views.mu.Unlock()
+	return func() {
+		views.mu.Lock()
+		delete(views.pending, key)
+		views.mu.Unlock()
+		lock.Unlock()
+	}
+}
+
+func (views *transferViews) get(name string) (netbox.Zone, bool) {
+	if views == nil {
+		return netbox.Zone{}, false
+	}
+	views.mu.Lock()
+	defer views.mu.Unlock()
+	zone, ok := views.pending[fqdnKey(name)]
+	return zone, ok
+}
+
+// serveTransfer selects the zone matching the view of the requester and hands
+// the request to the next plugin, which is expected to be transfer.
+func (netboxdns *NetboxDNS) serveTransfer(
+	ctx context.Context,
+	writer dns.ResponseWriter,
+	request *dns.Msg,
+	qname string,
+	reqIP netip.Addr,
+	viewName string,
+) (int, error) {
+	zoneCtx, cancel := netboxdns.queryContext(ctx)
+	zone, err := netboxdns.transferZone(zoneCtx, qname, reqIP, viewName)
+	cancel()
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	if zone == nil {
+		logger.Debugf("no zone %q in a view matching %v for transfer", qname, reqIP)
+		return netboxdns.nextOrFailure(ctx, writer, request)
+	}
+	release := netboxdns.transferViews.acquire(*zone)
+	defer release()
+	return netboxdns.nextOrFailure(ctx, writer, request)
+}
+
+// transferZone returns the zone named qname in the view of the requester at
+// reqIP that takes precedence, or in the view named viewName if set. If none
+// of its views has the zone, the zone in the default view is returned.
+func (netboxdns *NetboxDNS) transferZone(
+	ctx context.Context,
+	qname string,
+	reqIP netip.Addr,
+	viewName string,
+) (*netbox.Zone, error) {
+	span, ctx := netbox.StartSpan(ctx, "transferZone")
+	defer span.Finish()
+	zone, err := netboxdns.viewZone(ctx, qname, reqIP, viewName)
+	if err != nil || zone != nil {
+		return zone, err
+	}
+	zones, err := netboxdns.zonesNamed(ctx, qname)
+	if err != nil {
+		return nil, err
+	}
+	for i, zone := range zones {
+		view, err := netboxdns.getView(ctx, zone.View.ID)
+		if err != nil {
+			return nil, err
+		}
+		if view.Default {
+			return &zones[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// zonesNamed returns the zones named name across all views
+func (netboxdns *NetboxDNS) zonesNamed(ctx context.Context, name string) ([]netbox.Zone, error) {
+	managedZones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []netbox.Zone
+	for _, zone := range managedZones {
+		if fqdnKey(zone.Name) == fqdnKey(name) {
+			out = append(out, zone)
+		}
+	}
+	return out, nil
+}
+
+// Transfer implements the transfer.Transferer interface
+func (netboxdns *NetboxDNS) Transfer(
+	zoneName string,
+	serial uint32,
+) (<-chan []dns.RR, error) {
+	if plugin.Zones(netboxdns.zones).Matches(zoneName) == "" {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	// the transfer plugin does not pass the context of the request
+	ctx := netboxdns.backgroundContext()
+	zone, ok := netboxdns.transferViews.get(zoneName)
+	if !ok {
+		// called without a view selected by ServeDNS; use the default view
+		defaultZone, err := netboxdns.transferZone(ctx, zoneName, netip.Addr{}, "")
+		if err != nil {
+			return nil, err
+		}
+		if defaultZone == nil {
+			return nil, transfer.ErrNotAuthoritative
+		}
+		zone = *defaultZone
+	}
+
+	soa, rrs, err := netboxdns.zoneRRs(ctx, &zone)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+		if serial != 0 {
+			if !serialNewer(soa.Serial, serial) {
+				// IXFR for a serial that is current
+				ch <- []dns.RR{soa}
+				return
+			}
+			if diff := netboxdns.journalDiff(zone.ID, serial, soa.Serial); diff != nil {
+				sendIXFR(ch, diff)
+				return
+			}
+			logger.Debugf(
+				"serial %d of zone %q not in journal; falling back to AXFR",
+				serial,
+				zone.Name,
+			)
+		}
+		sendAXFR(ch, soa, rrs)
+	}()
+	return ch, nil
+}
+
+// sendAXFR writes the zone to ch framed by its SOA record
+func sendAXFR(ch chan<- []dns.RR, soa *dns.SOA, rrs []dns.RR) {
+	ch <- []dns.RR{soa}
+	for start := 0; start < len(rrs); start += transferBatchSize {
+		end := min(start+transferBatchSize, len(rrs))
+		ch <- rrs[start:end]
+	}
+	ch <- []dns.RR{soa}
+}
+
+// zoneRRs returns the SOA record of zone and all of its other records
+func (netboxdns *NetboxDNS) zoneRRs(
+	ctx context.Context,
+	zone *netbox.Zone,
+) (*dns.SOA, []dns.RR, error) {
+	records, err := netboxdns.getRecords(ctx, &netbox.RecordQuery{Zone: zone})
+	if err != nil {
+		return nil, nil, err
+	}
+	rrs, err := recordsToRR(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	var soa *dns.SOA
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+			continue
+		}
+		out = append(out, rr)
+	}
+	if soa == nil {
+		return nil, nil, fmt.Errorf(
+			"zone %q in view %q has no SOA record",
+			zone.Name,
+			zone.View.Name,
+		)
+	}
+	return soa, out, nil
+}
+
+// serialNewer reports whether serial a is newer than b using RFC 1982 serial
+// number arithmetic
+func serialNewer(a uint32, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+func isTransfer(qtype uint16) bool {
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
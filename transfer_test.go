@@ -0,0 +1,150 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
+)
+
+func collectTransfer(t *testing.T, ch <-chan []dns.RR) []dns.RR {
+	t.Helper()
+	var out []dns.RR
+	for rrs := range ch {
+		out = append(out, rrs...)
+	}
+	return out
+}
+
+func TestTransferDefaultView(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	ch, err := netboxdns.Transfer("example.com.", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	rrs := collectTransfer(t, ch)
+	// SOA, A, AAAA, CNAME, A, SOA
+	if len(rrs) != 6 {
+		t.Fatalf("got %d records, want 6: %v", len(rrs), rrs)
+	}
+	first, ok := rrs[0].(*dns.SOA)
+	if !ok || first.Serial != 1 {
+		t.Errorf("transfer does not start with SOA of the default view: %v", rrs[0])
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		t.Errorf("transfer does not end with SOA: %v", rrs[len(rrs)-1])
+	}
+	for _, rr := range rrs {
+		if cname, ok := rr.(*dns.CNAME); ok && cname.Target != "web.example.com." {
+			t.Errorf("relative CNAME target not completed with origin: %v", cname)
+		}
+	}
+}
+
+func TestTransferSelectedView(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	zone, err := netboxdns.transferZone(context.Background(), "example.com.", netip.MustParseAddr("10.2.3.4"), "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if zone == nil || zone.View.ID != 2 {
+		t.Fatalf("expected zone in internal view, got %v", zone)
+	}
+	release := netboxdns.transferViews.acquire(*zone)
+	ch, err := netboxdns.Transfer("example.com.", 0)
+	release()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	rrs := collectTransfer(t, ch)
+	if len(rrs) != 3 {
+		t.Fatalf("got %d records, want 3: %v", len(rrs), rrs)
+	}
+	if soa := rrs[0].(*dns.SOA); soa.Serial != 7 {
+		t.Errorf("got serial %d, want 7", soa.Serial)
+	}
+}
+
+func TestTransferCurrentSerial(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	ch, err := netboxdns.Transfer("example.com.", 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rrs := collectTransfer(t, ch); len(rrs) != 1 {
+		t.Errorf("expected single SOA for current serial, got %v", rrs)
+	}
+}
+
+func TestTransferNotAuthoritative(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	if _, err := netboxdns.Transfer("example.net.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("expected ErrNotAuthoritative, got %v", err)
+	}
+	netboxdns.zones = []string{"example.org."}
+	if _, err := netboxdns.Transfer("example.com.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("expected ErrNotAuthoritative, got %v", err)
+	}
+}
+
+// testTransferHandler stands in for the transfer plugin, which calls Transfer
+// from its ServeDNS and writes the records it receives
+func testTransferHandler(t *testing.T, transferer *NetboxDNS) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, writer dns.ResponseWriter, request *dns.Msg) (int, error) {
+		// give a transfer of another view the chance to select its zone
+		time.Sleep(time.Millisecond)
+		ch, err := transferer.Transfer(request.Question[0].Name, 0)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		msg := new(dns.Msg)
+		msg.SetReply(request)
+		msg.Answer = collectTransfer(t, ch)
+		writer.WriteMsg(msg)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestTransferParallelViews(t *testing.T) {
+	netboxdns := newTestPlugin(t, withInternalView())
+	netboxdns.Next = testTransferHandler(t, netboxdns)
+	clients := []struct {
+		ip     string
+		serial uint32
+	}{
+		{"10.2.3.4", 7},
+		{"192.0.2.1", 1},
+	}
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := new(dns.Msg)
+				req.SetAxfr("example.com.")
+				rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: client.ip, TCP: true})
+				if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				if rec.Msg == nil || len(rec.Msg.Answer) == 0 {
+					t.Errorf("got no records for %s", client.ip)
+					return
+				}
+				soa, ok := rec.Msg.Answer[0].(*dns.SOA)
+				if !ok || soa.Serial != client.serial {
+					t.Errorf("got transfer starting with %v for %s, want serial %d", rec.Msg.Answer[0], client.ip, client.serial)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
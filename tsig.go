@@ -0,0 +1,163 @@
+package netboxdns
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	tsigOperationQuery    string = "query"
+	tsigOperationTransfer string = "transfer"
+	tsigOperationUpdate   string = "update"
+)
+
+// tsigConfig holds the TSIG keys of the plugin and the keys operations on
+// zones are restricted to. The keys are verified by the server, which signs
+// the responses as well.
+type tsigConfig struct {
+	// secrets maps key names to their base64 secrets
+	secrets map[string]string
+	acls    []tsigACL
+}
+
+// tsigACL restricts an operation on the names within zone to keys
+type tsigACL struct {
+	zone      string
+	operation string
+	keys      map[string]bool
+}
+
+func newTSIGConfig() *tsigConfig {
+	return &tsigConfig{secrets: make(map[string]string)}
+}
+
+// allowed reports whether operation on name may be done with the verified key,
+// or without a key if key is empty. The ACL of the most specific zone
+// containing name decides; operations without an ACL are allowed.
+func (config *tsigConfig) allowed(operation string, name string, key string) bool {
+	if config == nil {
+		return true
+	}
+	var acl *tsigACL
+	for i, candidate := range config.acls {
+		if candidate.operation != operation || !dns.IsSubDomain(candidate.zone, name) {
+			continue
+		}
+		if acl == nil || len(candidate.zone) > len(acl.zone) {
+			acl = &config.acls[i]
+		}
+	}
+	if acl == nil {
+		return true
+	}
+	return key != "" && acl.keys[key]
+}
+
+// requestOperation returns the operation the request asks for
+func requestOperation(reqMsg *dns.Msg, qtype uint16) string {
+	switch {
+	case reqMsg.Opcode == dns.OpcodeUpdate:
+		return tsigOperationUpdate
+	case isTransfer(qtype):
+		return tsigOperationTransfer
+	}
+	return tsigOperationQuery
+}
+
+// verifiedKey returns the name of the TSIG key that signed the request if the
+// server verified the signature, or an empty string
+func verifiedKey(writer dns.ResponseWriter, reqMsg *dns.Msg) string {
+	tsig := reqMsg.IsTsig()
+	if tsig == nil || writer.TsigStatus() != nil {
+		return ""
+	}
+	return fqdnKey(tsig.Hdr.Name)
+}
+
+// writeTSIGError answers a request whose signature could not be verified with
+// NOTAUTH and the TSIG error described in RFC 8945 section 5.2
+func writeTSIGError(writer dns.ResponseWriter, reqMsg *dns.Msg, status error) {
+	tsig := reqMsg.IsTsig()
+	respMsg := new(dns.Msg)
+	respMsg.SetRcode(reqMsg, dns.RcodeNotAuth)
+	respMsg.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	respTSIG := respMsg.IsTsig()
+	switch {
+	case errors.Is(status, dns.ErrSecret):
+		respTSIG.Error = dns.RcodeBadKey
+	case errors.Is(status, dns.ErrTime):
+		// the time of the request is returned with the error
+		respTSIG.Error = dns.RcodeBadTime
+		respTSIG.TimeSigned = tsig.TimeSigned
+	default:
+		respTSIG.Error = dns.RcodeBadSig
+	}
+	writer.WriteMsg(respMsg)
+}
+
+// tsigResponseWriter adds a TSIG RR for the key of the request to responses,
+// which the server fills with the signature
+type tsigResponseWriter struct {
+	dns.ResponseWriter
+	reqTSIG *dns.TSIG
+}
+
+// WriteMsg implements the dns.ResponseWriter interface
+func (writer *tsigResponseWriter) WriteMsg(respMsg *dns.Msg) error {
+	if respMsg.IsTsig() == nil {
+		respMsg.SetTsig(
+			writer.reqTSIG.Hdr.Name,
+			writer.reqTSIG.Algorithm,
+			writer.reqTSIG.Fudge,
+			time.Now().Unix(),
+		)
+	}
+	return writer.ResponseWriter.WriteMsg(respMsg)
+}
+
+// authorize checks the TSIG signature of a request and the ACL of its
+// operation. It returns the writer for the response, which is signed if the
+// request is, and whether the request was answered with an error.
+func (netboxdns *NetboxDNS) authorize(
+	writer dns.ResponseWriter,
+	reqMsg *dns.Msg,
+	qname string,
+	qtype uint16,
+) (dns.ResponseWriter, bool) {
+	if netboxdns.tsig == nil {
+		return writer, false
+	}
+	if tsig := reqMsg.IsTsig(); tsig != nil {
+		if status := writer.TsigStatus(); status != nil {
+			logger.Debugf("TSIG of request for %q not verified: %v", qname, status)
+			writeTSIGError(writer, reqMsg, status)
+			return writer, true
+		}
+		writer = &tsigResponseWriter{ResponseWriter: writer, reqTSIG: tsig}
+	}
+	operation := requestOperation(reqMsg, qtype)
+	key := verifiedKey(writer, reqMsg)
+	if !netboxdns.tsig.allowed(operation, qname, key) {
+		logger.Debugf("refusing %s of %q with key %q", operation, qname, key)
+		respMsg := new(dns.Msg)
+		respMsg.SetRcode(reqMsg, dns.RcodeRefused)
+		writer.WriteMsg(respMsg)
+		return writer, true
+	}
+	return writer, false
+}
+
+// registerTSIGSecrets adds the keys of the plugin to the secrets the server
+// verifies requests with. A key configured differently elsewhere is an error.
+func registerTSIGSecrets(serverSecrets map[string]string, secrets map[string]string) error {
+	for name, secret := range secrets {
+		if existing, ok := serverSecrets[name]; ok && existing != secret {
+			return fmt.Errorf("TSIG key %q is configured with another secret", name)
+		}
+		serverSecrets[name] = secret
+	}
+	return nil
+}
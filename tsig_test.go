@@ -0,0 +1,130 @@
+package netboxdns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// tsigStatusWriter reports the given status for the TSIG of requests
+type tsigStatusWriter struct {
+	test.ResponseWriter
+	status error
+}
+
+func (writer *tsigStatusWriter) TsigStatus() error {
+	return writer.status
+}
+
+func TestTSIGAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		qtype   uint16
+		key     string
+		status  error
+		rcode   int
+		tsigErr uint16
+	}{
+		{
+			name:  "query without key",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name:  "query with key",
+			qtype: dns.TypeA,
+			key:   "other.key.",
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "transfer with other key",
+			qtype: dns.TypeAXFR,
+			key:   "other.key.",
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name:    "unknown key",
+			qtype:   dns.TypeA,
+			key:     "unknown.key.",
+			status:  dns.ErrSecret,
+			rcode:   dns.RcodeNotAuth,
+			tsigErr: dns.RcodeBadKey,
+		},
+		{
+			name:    "bad signature",
+			qtype:   dns.TypeAXFR,
+			key:     "transfer.key.",
+			status:  dns.ErrSig,
+			rcode:   dns.RcodeNotAuth,
+			tsigErr: dns.RcodeBadSig,
+		},
+		{
+			name:    "bad time",
+			qtype:   dns.TypeA,
+			key:     "other.key.",
+			status:  dns.ErrTime,
+			rcode:   dns.RcodeNotAuth,
+			tsigErr: dns.RcodeBadTime,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t, withTSIG())
+			req := new(dns.Msg)
+			req.SetQuestion("web.example.com.", tt.qtype)
+			if tt.key != "" {
+				req.SetTsig(tt.key, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			rec := dnstest.NewRecorder(&tsigStatusWriter{status: tt.status})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			respTSIG := rec.Msg.IsTsig()
+			if tt.key == "" {
+				if respTSIG != nil {
+					t.Errorf("expected unsigned response, got %v", respTSIG)
+				}
+				return
+			}
+			if respTSIG == nil || respTSIG.Hdr.Name != tt.key {
+				t.Fatalf("expected response signed with %q, got %v", tt.key, respTSIG)
+			}
+			if respTSIG.Error != tt.tsigErr {
+				t.Errorf("got TSIG error %d, want %d", respTSIG.Error, tt.tsigErr)
+			}
+		})
+	}
+}
+
+func TestTSIGAllowed(t *testing.T) {
+	config := newTSIGConfig()
+	config.acls = []tsigACL{
+		{zone: "example.com.", operation: tsigOperationUpdate, keys: map[string]bool{"a.key.": true}},
+		{zone: "dyn.example.com.", operation: tsigOperationUpdate, keys: map[string]bool{"b.key.": true}},
+	}
+	tests := []struct {
+		operation string
+		name      string
+		key       string
+		want      bool
+	}{
+		{tsigOperationUpdate, "example.com.", "a.key.", true},
+		{tsigOperationUpdate, "host.dyn.example.com.", "a.key.", false},
+		{tsigOperationUpdate, "host.dyn.example.com.", "b.key.", true},
+		{tsigOperationUpdate, "example.com.", "", false},
+		{tsigOperationUpdate, "example.org.", "", true},
+		{tsigOperationQuery, "example.com.", "", true},
+	}
+	for _, tt := range tests {
+		if got := config.allowed(tt.operation, tt.name, tt.key); got != tt.want {
+			t.Errorf("allowed(%s, %s, %q) = %t, want %t", tt.operation, tt.name, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package netboxdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// updateConfig accepts dynamic updates (RFC 2136) for Netbox zones and writes
+// them to Netbox
+type updateConfig struct {
+	// zones limits the zones updates are accepted for
+	zones []string
+}
+
+// updateEntry is a record of the zone being updated with its resource record
+type updateEntry struct {
+	record netbox.Record
+	rr     dns.RR
+}
+
+// serveUpdate processes an UPDATE message and answers it with the resulting
+// rcode. Updates are only accepted with a TSIG signature verified by the
+// server.
+func (netboxdns *NetboxDNS) serveUpdate(
+	ctx context.Context,
+	writer dns.ResponseWriter,
+	reqMsg *dns.Msg,
+	reqIP netip.Addr,
+	viewName string,
+) (int, error) {
+	rcode, err := netboxdns.processUpdate(ctx, writer, reqMsg, reqIP, viewName)
+	if err != nil {
+		logger.Errorf("could not apply update from %v: %v", reqIP, err)
+	}
+	respMsg := new(dns.Msg)
+	respMsg.SetRcode(reqMsg, rcode)
+	writer.WriteMsg(respMsg)
+	return dns.RcodeSuccess, nil
+}
+
+// processUpdate checks and applies reqMsg as described in RFC 2136 section 3
+// and returns the rcode of the response
+func (netboxdns *NetboxDNS) processUpdate(
+	ctx context.Context,
+	writer dns.ResponseWriter,
+	reqMsg *dns.Msg,
+	reqIP netip.Addr,
+	viewName string,
+) (int, error) {
+	span, ctx := netbox.StartSpan(ctx, "processUpdate")
+	defer span.Finish()
+	if netboxdns.updates == nil {
+		return dns.RcodeRefused, nil
+	}
+	if reqMsg.IsTsig() == nil || writer.TsigStatus() != nil {
+		logger.Debugf("refusing unsigned update from %v", reqIP)
+		return dns.RcodeRefused, nil
+	}
+	if len(reqMsg.Question) != 1 || reqMsg.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError, nil
+	}
+	zoneName := fqdnKey(reqMsg.Question[0].Name)
+	zone, err := netboxdns.viewZone(ctx, zoneName, reqIP, viewName)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	if zone == nil {
+		return dns.RcodeNotAuth, nil
+	}
+	if plugin.Zones(netboxdns.updates.zones).Matches(zoneName) == "" {
+		return dns.RcodeRefused, nil
+	}
+	records, err := netboxdns.getRecords(ctx, &netbox.RecordQuery{Zone: zone})
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	entries, err := updateEntries(records)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	// the prerequisite section is sent as the answer section
+	if rcode := checkPrerequisites(entries, reqMsg.Answer, zoneName); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	// the update section is sent as the authority section
+	if rcode := prescanUpdates(reqMsg.Ns, zoneName); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	// an update is applied entirely or not at all (RFC 2136 section 3.4), so
+	// the changes made before a failing one are reverted
+	var rollback updateRollback
+	for _, rr := range reqMsg.Ns {
+		entries, err = netboxdns.applyUpdate(ctx, zone, entries, rr, &rollback)
+		if err != nil {
+			// the query context may be the reason the update failed
+			if undoErr := rollback.undo(netboxdns.backgroundContext()); undoErr != nil {
+				logger.Errorf(
+					"could not roll back update to %q from %v, which is partially applied: %v",
+					zoneName,
+					reqIP,
+					undoErr,
+				)
+			}
+			return updateRcode(err), err
+		}
+	}
+	logger.Infof("applied %d updates to %q from %v", len(reqMsg.Ns), zoneName, reqIP)
+	return dns.RcodeSuccess, nil
+}
+
+func updateEntries(records []netbox.Record) ([]updateEntry, error) {
+	out := make([]updateEntry, 0, len(records))
+	for _, record := range records {
+		rrs, err := recordsToRR([]netbox.Record{record})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, updateEntry{record: record, rr: rrs[0]})
+	}
+	return out, nil
+}
+
+// checkPrerequisites returns the rcode of the first prerequisite that is not
+// met as described in RFC 2136 section 3.2
+func checkPrerequisites(entries []updateEntry, prereqs []dns.RR, zoneName string) int {
+	// value dependent prerequisites are compared per RRset once collected
+	required := make(map[string][]dns.RR)
+	for _, rr := range prereqs {
+		header := rr.Header()
+		name := fqdnKey(header.Name)
+		if header.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zoneName, name) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassANY:
+			if !isEmptyRR(rr) {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if len(rrset(entries, name, dns.TypeANY)) == 0 {
+					return dns.RcodeNameError
+				}
+			} else if len(rrset(entries, name, header.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if !isEmptyRR(rr) {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if len(rrset(entries, name, dns.TypeANY)) > 0 {
+					return dns.RcodeYXDomain
+				}
+			} else if len(rrset(entries, name, header.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			key := name + "/" + dns.TypeToString[header.Rrtype]
+			required[key] = append(required[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	for _, rrs := range required {
+		header := rrs[0].Header()
+		if !sameRRset(rrset(entries, fqdnKey(header.Name), header.Rrtype), rrs) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescanUpdates checks the update section as described in RFC 2136 section
+// 3.4.1
+func prescanUpdates(updates []dns.RR, zoneName string) int {
+	for _, rr := range updates {
+		header := rr.Header()
+		if !dns.IsSubDomain(zoneName, fqdnKey(header.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassINET:
+			if isMetaType(header.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if header.Ttl != 0 || !isEmptyRR(rr) || isMetaType(header.Rrtype) &&
+				header.Rrtype != dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if header.Ttl != 0 || isMetaType(header.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// updateRollback holds the changes that revert the changes an update made to
+// Netbox and the snapshot
+type updateRollback []func(ctx context.Context) error
+
+func (rollback *updateRollback) add(undo func(ctx context.Context) error) {
+	*rollback = append(*rollback, undo)
+}
+
+// undo reverts the changes in reverse order. Changes that cannot be reverted
+// are skipped and their errors returned.
+func (rollback updateRollback) undo(ctx context.Context) error {
+	var errs []error
+	for i := len(rollback) - 1; i >= 0; i-- {
+		if err := rollback[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyUpdate applies a single RR of the update section to Netbox and the
+// snapshot and returns the changed entries of the zone. Changes Netbox does
+// not allow, such as those to SOA, apex NS and managed records, are ignored.
+// The reverse of every change made is added to rollback.
+func (netboxdns *NetboxDNS) applyUpdate(
+	ctx context.Context,
+	zone *netbox.Zone,
+	entries []updateEntry,
+	rr dns.RR,
+	rollback *updateRollback,
+) ([]updateEntry, error) {
+	header := rr.Header()
+	name := fqdnKey(header.Name)
+	apex := name == fqdnKey(zone.Name)
+	switch header.Class {
+	case dns.ClassINET:
+		if header.Rrtype == dns.TypeSOA || apex && header.Rrtype == dns.TypeNS {
+			return entries, nil
+		}
+		// CNAME records cannot coexist with other data (RFC 2136 3.4.2.2)
+		for _, entry := range rrset(entries, name, dns.TypeANY) {
+			isCNAME := entry.rr.Header().Rrtype == dns.TypeCNAME
+			if isCNAME != (header.Rrtype == dns.TypeCNAME) {
+				return entries, nil
+			}
+		}
+		for _, entry := range rrset(entries, name, header.Rrtype) {
+			duplicate := dns.IsDuplicate(entry.rr, rr)
+			// an existing CNAME is replaced rather than added to
+			if !duplicate && header.Rrtype != dns.TypeCNAME {
+				continue
+			}
+			if duplicate && entry.rr.Header().Ttl == header.Ttl || !changeable(entry.record) {
+				return entries, nil
+			}
+			ttl := header.Ttl
+			change := &netbox.RecordWrite{TTL: &ttl}
+			if !duplicate {
+				change.Value = rdata(rr)
+			}
+			record, err := netbox.UpdateRecord(
+				ctx,
+				netboxdns.requestClient,
+				entry.record.ID,
+				change,
+			)
+			if err != nil {
+				return entries, err
+			}
+			netboxdns.putUpdatedRecord(record)
+			rollback.add(netboxdns.restoreRecord(entry.record))
+			return replaceEntry(entries, updateEntry{record: record, rr: rr}), nil
+		}
+		ttl := header.Ttl
+		record, err := netbox.CreateRecord(
+			ctx,
+			netboxdns.requestClient,
+			&netbox.RecordWrite{
+				Zone:  zone.ID,
+				Name:  relativeName(name, zone.Name),
+				Type:  dns.TypeToString[header.Rrtype],
+				Value: rdata(rr),
+				TTL:   &ttl,
+			},
+		)
+		if err != nil {
+			return entries, err
+		}
+		netboxdns.putUpdatedRecord(record)
+		rollback.add(netboxdns.removeRecord(record))
+		return append(entries, updateEntry{record: record, rr: rr}), nil
+	case dns.ClassANY, dns.ClassNONE:
+		var out []updateEntry
+		for _, entry := range entries {
+			entryHeader := entry.rr.Header()
+			matches := fqdnKey(entryHeader.Name) == name &&
+				(header.Rrtype == dns.TypeANY || entryHeader.Rrtype == header.Rrtype)
+			if matches && header.Class == dns.ClassNONE {
+				// RRs to delete are sent with class NONE
+				inet := dns.Copy(rr)
+				inet.Header().Class = dns.ClassINET
+				matches = dns.IsDuplicate(entry.rr, inet)
+			}
+			protected := entryHeader.Rrtype == dns.TypeSOA ||
+				apex && entryHeader.Rrtype == dns.TypeNS
+			if !matches || protected || !changeable(entry.record) {
+				out = append(out, entry)
+				continue
+			}
+			err := netbox.DeleteRecord(ctx, netboxdns.requestClient, entry.record.ID)
+			if err != nil && !netbox.IsNotFound(err) {
+				return entries, err
+			}
+			if netboxdns.snapshot.ready() {
+				netboxdns.snapshot.deleteRecord(entry.record.ID)
+			}
+			if err == nil {
+				rollback.add(netboxdns.recreateRecord(entry.record))
+			}
+		}
+		return out, nil
+	}
+	return entries, nil
+}
+
+// restoreRecord returns the change that sets the value and TTL of a record
+// back to those of previous
+func (netboxdns *NetboxDNS) restoreRecord(previous netbox.Record) func(context.Context) error {
+	return func(ctx context.Context) error {
+		record, err := netbox.UpdateRecord(
+			ctx,
+			netboxdns.requestClient,
+			previous.ID,
+			&netbox.RecordWrite{Value: previous.Value, TTL: previous.TTL},
+		)
+		if err != nil {
+			return err
+		}
+		netboxdns.putUpdatedRecord(record)
+		return nil
+	}
+}
+
+// removeRecord returns the change that deletes a created record
+func (netboxdns *NetboxDNS) removeRecord(created netbox.Record) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := netbox.DeleteRecord(ctx, netboxdns.requestClient, created.ID)
+		if err != nil && !netbox.IsNotFound(err) {
+			return err
+		}
+		if netboxdns.snapshot.ready() {
+			netboxdns.snapshot.deleteRecord(created.ID)
+		}
+		return nil
+	}
+}
+
+// recreateRecord returns the change that creates a deleted record again.
+// Netbox gives it a new ID.
+func (netboxdns *NetboxDNS) recreateRecord(deleted netbox.Record) func(context.Context) error {
+	return func(ctx context.Context) error {
+		record, err := netbox.CreateRecord(
+			ctx,
+			netboxdns.requestClient,
+			&netbox.RecordWrite{
+				Zone:  deleted.Zone.ID,
+				Name:  deleted.Name,
+				Type:  deleted.Type,
+				Value: deleted.Value,
+				TTL:   deleted.TTL,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		netboxdns.putUpdatedRecord(record)
+		return nil
+	}
+}
+
+// replaceEntry returns entries with the entry of the same record replaced
+func replaceEntry(entries []updateEntry, replacement updateEntry) []updateEntry {
+	out := make([]updateEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.record.ID == replacement.record.ID {
+			entry = replacement
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// putUpdatedRecord stores a record written to Netbox in the snapshot, so that
+// it is served before the next refresh
+func (netboxdns *NetboxDNS) putUpdatedRecord(record netbox.Record) {
+	if netboxdns.snapshot.ready() {
+		netboxdns.snapshot.putRecord(record)
+	}
+}
+
+// changeable reports whether record exists in Netbox and may be changed
+func changeable(record netbox.Record) bool {
+	return record.ID > 0 && !record.Managed
+}
+
+// rrset returns the entries named name of type rrtype, or of any type for
+// dns.TypeANY
+func rrset(entries []updateEntry, name string, rrtype uint16) []updateEntry {
+	var out []updateEntry
+	for _, entry := range entries {
+		header := entry.rr.Header()
+		if fqdnKey(header.Name) != name {
+			continue
+		}
+		if rrtype == dns.TypeANY || header.Rrtype == rrtype {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// sameRRset reports whether entries and rrs hold the same records, ignoring
+// TTLs
+func sameRRset(entries []updateEntry, rrs []dns.RR) bool {
+	contains := func(rr dns.RR) bool {
+		for _, entry := range entries {
+			if dns.IsDuplicate(entry.rr, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range rrs {
+		if !contains(rr) {
+			return false
+		}
+	}
+	for _, entry := range entries {
+		found := false
+		for _, rr := range rrs {
+			if dns.IsDuplicate(entry.rr, rr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyRR reports whether rr has no RDATA, as RRs of class ANY and NONE in
+// the prerequisite section must
+func isEmptyRR(rr dns.RR) bool {
+	if _, ok := rr.(*dns.ANY); ok {
+		return true
+	}
+	return rr.Header().Rdlength == 0
+}
+
+func isMetaType(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB,
+		dns.TypeOPT, dns.TypeTSIG:
+		return true
+	}
+	return false
+}
+
+// rdata returns the presentation format of the RDATA of rr, which is how
+// Netbox stores record values
+func rdata(rr dns.RR) string {
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// updateRcode maps an error writing to Netbox to the rcode of the response
+func updateRcode(err error) int {
+	var apiError *netbox.APIError
+	if !errors.As(err, &apiError) {
+		return dns.RcodeServerFailure
+	}
+	switch apiError.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		// Netbox rejected the record, e.g. for an invalid value, or the API
+		// token may not change records
+		return dns.RcodeRefused
+	case http.StatusNotFound:
+		// the zone was deleted in the meantime
+		return dns.RcodeNotAuth
+	}
+	return dns.RcodeServerFailure
+}
@@ -0,0 +1,334 @@
+package netboxdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// testRecordsAPI serves the records endpoint of netbox-plugin-dns from the
+// records of a snapshot and remembers the requests that change them
+type testRecordsAPI struct {
+	mu       sync.Mutex
+	records  map[int]netbox.Record
+	nextID   int
+	requests []string
+}
+
+func newTestRecordsAPI(records []netbox.Record) *testRecordsAPI {
+	api := &testRecordsAPI{records: make(map[int]netbox.Record), nextID: 100}
+	for _, record := range records {
+		api.records[record.ID] = record
+	}
+	return api
+}
+
+func (api *testRecordsAPI) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	path := strings.TrimPrefix(request.URL.Path, "/api/plugins/netbox-dns/records/")
+	api.requests = append(api.requests, request.Method+" "+path)
+	var body netbox.RecordWrite
+	if request.Body != nil {
+		json.NewDecoder(request.Body).Decode(&body)
+	}
+	if strings.Trim(body.Value, `"`) == "invalid" {
+		http.Error(writer, `{"value":["invalid value"]}`, http.StatusBadRequest)
+		return
+	}
+	id, _ := strconv.Atoi(strings.TrimSuffix(path, "/"))
+	record := api.records[id]
+	switch request.Method {
+	case http.MethodPost:
+		record = netbox.Record{
+			ID:    api.nextID,
+			Name:  body.Name,
+			Type:  body.Type,
+			Value: body.Value,
+			TTL:   body.TTL,
+			Zone:  netbox.Zone{ID: body.Zone, Name: "example.com"},
+			FQDN:  body.Name + ".example.com.",
+		}
+		api.nextID++
+		writer.WriteHeader(http.StatusCreated)
+	case http.MethodPatch:
+		if body.Value != "" {
+			record.Value = body.Value
+		}
+		record.TTL = body.TTL
+	case http.MethodDelete:
+		delete(api.records, id)
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	api.records[record.ID] = record
+	json.NewEncoder(writer).Encode(record)
+}
+
+func TestUpdate(t *testing.T) {
+	rr := func(s string) dns.RR {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+	tests := []struct {
+		name     string
+		zone     string
+		prepare  func(msg *dns.Msg)
+		unsigned bool
+		rcode    int
+		requests []string
+	}{
+		{
+			name: "unsigned",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("new.example.com. 300 IN A 10.0.0.50")})
+			},
+			unsigned: true,
+			rcode:    dns.RcodeRefused,
+		},
+		{
+			name: "add record",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("new.example.com. 300 IN A 10.0.0.50")})
+			},
+			requests: []string{"POST "},
+		},
+		{
+			name: "add existing record",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("web.example.com. 3600 IN A 10.0.0.17")})
+			},
+		},
+		{
+			name: "change ttl of existing record",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("web.example.com. 60 IN A 10.0.0.17")})
+			},
+			requests: []string{"PATCH 2/"},
+		},
+		{
+			name: "add CNAME to name with data",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("web.example.com. 300 IN CNAME other.example.com.")})
+			},
+		},
+		{
+			name: "replace CNAME",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("www.example.com. 300 IN CNAME other.example.com.")})
+			},
+			requests: []string{"PATCH 4/"},
+		},
+		{
+			name: "delete RRset",
+			prepare: func(msg *dns.Msg) {
+				msg.RemoveRRset([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+			},
+			requests: []string{"DELETE 2/"},
+		},
+		{
+			name: "delete record",
+			prepare: func(msg *dns.Msg) {
+				msg.Remove([]dns.RR{rr("web.example.com. 300 IN AAAA 2001:db8::17")})
+			},
+			requests: []string{"DELETE 3/"},
+		},
+		{
+			name: "delete name",
+			prepare: func(msg *dns.Msg) {
+				msg.RemoveName([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+			},
+			requests: []string{"DELETE 2/", "DELETE 3/"},
+		},
+		{
+			name: "delete SOA is ignored",
+			prepare: func(msg *dns.Msg) {
+				msg.RemoveRRset([]dns.RR{rr("example.com. 0 IN SOA . . 0 0 0 0 0")})
+			},
+		},
+		{
+			name: "name in use",
+			prepare: func(msg *dns.Msg) {
+				msg.NameUsed([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+				msg.Insert([]dns.RR{rr("web.example.com. 300 IN TXT \"web\"")})
+			},
+			requests: []string{"POST "},
+		},
+		{
+			name: "name not in use",
+			prepare: func(msg *dns.Msg) {
+				msg.NameNotUsed([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+				msg.Insert([]dns.RR{rr("web.example.com. 300 IN A 10.0.0.50")})
+			},
+			rcode: dns.RcodeYXDomain,
+		},
+		{
+			name: "RRset does not exist",
+			prepare: func(msg *dns.Msg) {
+				msg.RRsetUsed([]dns.RR{rr("web.example.com. 0 IN MX 0 .")})
+			},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "RRset exists with values",
+			prepare: func(msg *dns.Msg) {
+				msg.Used([]dns.RR{rr("web.example.com. 0 IN A 10.0.0.17")})
+				msg.RemoveRRset([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+			},
+			requests: []string{"DELETE 2/"},
+		},
+		{
+			name: "RRset exists with other values",
+			prepare: func(msg *dns.Msg) {
+				msg.Used([]dns.RR{rr("web.example.com. 0 IN A 10.0.0.18")})
+			},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "name outside zone",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("web.example.net. 300 IN A 10.0.0.50")})
+			},
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name:  "unknown zone",
+			zone:  "example.net.",
+			rcode: dns.RcodeNotAuth,
+		},
+		{
+			name:  "zone without updates",
+			zone:  "sub.example.com.",
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "rejected by Netbox",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("new.example.com. 300 IN TXT invalid")})
+			},
+			rcode:    dns.RcodeRefused,
+			requests: []string{"POST "},
+		},
+		{
+			name: "rejected by Netbox after other changes",
+			prepare: func(msg *dns.Msg) {
+				msg.Insert([]dns.RR{rr("new.example.com. 300 IN A 10.0.0.50")})
+				msg.RemoveRRset([]dns.RR{rr("web.example.com. 0 IN A 0.0.0.0")})
+				msg.Insert([]dns.RR{rr("www.example.com. 300 IN CNAME other.example.com.")})
+				msg.Insert([]dns.RR{rr("new.example.com. 300 IN TXT invalid")})
+			},
+			rcode: dns.RcodeRefused,
+			// the changes before the rejected one are reverted in reverse
+			requests: []string{"POST ", "DELETE 2/", "PATCH 4/", "POST ", "PATCH 4/", "POST ", "DELETE 100/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var api *testRecordsAPI
+			netboxdns := newTestPlugin(t, withUpdates(&api))
+			if tt.name == "zone without updates" {
+				netboxdns.updates.zones = []string{"example.net."}
+			}
+			zone := tt.zone
+			if zone == "" {
+				zone = "example.com."
+			}
+			msg := new(dns.Msg)
+			msg.SetUpdate(zone)
+			if tt.prepare != nil {
+				tt.prepare(msg)
+			}
+			if !tt.unsigned {
+				msg.SetTsig("update.key.", dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, msg); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if strings.Join(api.requests, ", ") != strings.Join(tt.requests, ", ") {
+				t.Errorf("got requests %v, want %v", api.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestUpdateServesChanges(t *testing.T) {
+	netboxdns := newTestPlugin(t, withUpdates(new(*testRecordsAPI)))
+	msg := new(dns.Msg)
+	msg.SetUpdate("example.com.")
+	add, _ := dns.NewRR("new.example.com. 300 IN A 10.0.0.50")
+	msg.Insert([]dns.RR{add})
+	msg.SetTsig("update.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	netboxdns.ServeDNS(context.Background(), rec, msg)
+
+	tc := test.Case{
+		Qname: "new.example.com.", Qtype: dns.TypeA,
+		Answer: []dns.RR{test.A("new.example.com. 300 IN A 10.0.0.50")},
+	}
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, tc.Msg()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	var api *testRecordsAPI
+	netboxdns := newTestPlugin(t, withUpdates(&api))
+	values := func() []string {
+		var out []string
+		for _, record := range netboxdns.snapshot.getRecords(&netbox.RecordQuery{}) {
+			out = append(out, record.FQDN+" "+record.Type+" "+record.Value)
+		}
+		slices.Sort(out)
+		return out
+	}
+	before := values()
+	msg := new(dns.Msg)
+	msg.SetUpdate("example.com.")
+	add, _ := dns.NewRR("new.example.com. 300 IN A 10.0.0.50")
+	remove, _ := dns.NewRR("web.example.com. 0 IN A 0.0.0.0")
+	invalid, _ := dns.NewRR("new.example.com. 300 IN TXT invalid")
+	msg.Insert([]dns.RR{add})
+	msg.RemoveRRset([]dns.RR{remove})
+	msg.Insert([]dns.RR{invalid})
+	msg.SetTsig("update.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("got rcode %s, want REFUSED", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if after := values(); !slices.Equal(after, before) {
+		t.Errorf("got snapshot records %v after a failed update, want %v", after, before)
+	}
+	var stored []string
+	for _, record := range api.records {
+		stored = append(stored, record.FQDN+" "+record.Type+" "+record.Value)
+	}
+	slices.Sort(stored)
+	if !slices.Equal(stored, before) {
+		t.Errorf("got Netbox records %v after a failed update, want %v", stored, before)
+	}
+}
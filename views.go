@@ -0,0 +1,220 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strconv"
+
+	"github.com/coredns/coredns/request"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+// viewMapping selects views by the TSIG key that signed a request or the local
+// address that received it. It is evaluated before the prefixes of views.
+type viewMapping struct {
+	// tsig maps TSIG key names to view names
+	tsig map[string]string
+	// listeners are evaluated in the order they are configured
+	listeners []listenerView
+}
+
+// listenerView selects view for requests received on addr and port. A zero
+// addr or port matches any.
+type listenerView struct {
+	addr netip.Addr
+	port uint16
+	view string
+}
+
+func newViewMapping() *viewMapping {
+	return &viewMapping{tsig: make(map[string]string)}
+}
+
+// parseListener parses ADDRESS, ADDRESS:PORT or :PORT
+func parseListener(s string) (netip.Addr, uint16, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), addrPort.Port(), true
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), 0, true
+	}
+	if len(s) > 1 && s[0] == ':' {
+		port, err := strconv.ParseUint(s[1:], 10, 16)
+		if err == nil && port > 0 {
+			return netip.Addr{}, uint16(port), true
+		}
+	}
+	return netip.Addr{}, 0, false
+}
+
+// requestView returns the name of the view selected for the request by its
+// TSIG key or listener, or an empty string if views are selected by prefix.
+// Only keys that were verified by the server are considered.
+func (netboxdns *NetboxDNS) requestView(state request.Request) string {
+	mapping := netboxdns.viewMapping
+	if mapping == nil {
+		return ""
+	}
+	if tsig := state.Req.IsTsig(); tsig != nil && state.W.TsigStatus() == nil {
+		if view, ok := mapping.tsig[fqdnKey(tsig.Hdr.Name)]; ok {
+			return view
+		}
+	}
+	localIP, err := netip.ParseAddr(state.LocalIP())
+	if err != nil {
+		return ""
+	}
+	localIP = localIP.Unmap()
+	localPort, _ := strconv.ParseUint(state.LocalPort(), 10, 16)
+	for _, listener := range mapping.listeners {
+		if listener.addr.IsValid() && listener.addr != localIP {
+			continue
+		}
+		if listener.port != 0 && uint64(listener.port) != localPort {
+			continue
+		}
+		return listener.view
+	}
+	return ""
+}
+
+// clientViews returns the IDs of the views of the client at reqIP, the view
+// taking precedence first. If viewName is set, the view of that name is the
+// only one. Otherwise views are ranked by their longest prefix containing
+// reqIP, then by their position in view_order, then the Netbox default view
+// first and finally by ID. Clients outside all prefixes are given the
+// fallback view.
+func (netboxdns *NetboxDNS) clientViews(
+	ctx context.Context,
+	reqIP netip.Addr,
+	viewName string,
+) ([]int, error) {
+	views, err := netboxdns.zoneViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		view netbox.View
+		bits int
+	}
+	var candidates []candidate
+	for _, view := range views {
+		if viewName != "" {
+			if view.Name == viewName {
+				candidates = append(candidates, candidate{view: view})
+			}
+			continue
+		}
+		bits, err := view.MatchPrefix(reqIP)
+		if err != nil {
+			return nil, err
+		}
+		if bits >= 0 {
+			candidates = append(candidates, candidate{view: view, bits: bits})
+		}
+	}
+	if len(candidates) == 0 && viewName == "" {
+		for _, view := range views {
+			if netboxdns.isFallbackView(view) {
+				candidates = append(candidates, candidate{view: view})
+			}
+		}
+		logger.Debugf("no view prefix matches %v; using fallback view", reqIP)
+	}
+	order := make(map[string]int, len(netboxdns.viewOrder))
+	for i, name := range netboxdns.viewOrder {
+		order[name] = i
+	}
+	rank := func(view netbox.View) int {
+		if i, ok := order[view.Name]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.bits != b.bits:
+			return a.bits > b.bits
+		case rank(a.view) != rank(b.view):
+			return rank(a.view) < rank(b.view)
+		case a.view.Default != b.view.Default:
+			return a.view.Default
+		}
+		return a.view.ID < b.view.ID
+	})
+	out := make([]int, 0, len(candidates))
+	for _, candidate := range candidates {
+		out = append(out, candidate.view.ID)
+	}
+	return out, nil
+}
+
+// isFallbackView reports whether view is given to clients outside all view
+// prefixes, which is the configured fallback view or the Netbox default view
+func (netboxdns *NetboxDNS) isFallbackView(view netbox.View) bool {
+	if netboxdns.fallbackView != "" {
+		return view.Name == netboxdns.fallbackView
+	}
+	return view.Default
+}
+
+// zoneViews returns the views holding zones, ordered by ID
+func (netboxdns *NetboxDNS) zoneViews(ctx context.Context) ([]netbox.View, error) {
+	zones, err := netboxdns.getZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []netbox.View
+	seen := make(map[int]bool)
+	for _, zone := range zones {
+		if seen[zone.View.ID] {
+			continue
+		}
+		seen[zone.View.ID] = true
+		view, err := netboxdns.getView(ctx, zone.View.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, view)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// viewZone returns the zone named name in the view of the client at reqIP
+// that takes precedence among those having such a zone, or nil if none has
+func (netboxdns *NetboxDNS) viewZone(
+	ctx context.Context,
+	name string,
+	reqIP netip.Addr,
+	viewName string,
+) (*netbox.Zone, error) {
+	zones, err := netboxdns.zonesNamed(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	viewIDs, err := netboxdns.clientViews(ctx, reqIP, viewName)
+	if err != nil {
+		return nil, err
+	}
+	ranks := viewRanks(viewIDs)
+	var out *netbox.Zone
+	for i, zone := range zones {
+		rank, ok := ranks[zone.View.ID]
+		if ok && (out == nil || rank < ranks[out.View.ID]) {
+			out = &zones[i]
+		}
+	}
+	return out, nil
+}
+
+// viewRanks maps the IDs of views to their precedence, 0 being the highest
+func viewRanks(viewIDs []int) map[int]int {
+	out := make(map[int]int, len(viewIDs))
+	for i, id := range viewIDs {
+		out[id] = i
+	}
+	return out
+}
@@ -0,0 +1,241 @@
+package netboxdns
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// tsigFailedWriter is a ResponseWriter for requests whose TSIG the server
+// could not verify
+type tsigFailedWriter struct {
+	test.ResponseWriter
+}
+
+func (writer *tsigFailedWriter) TsigStatus() error {
+	return dns.ErrSig
+}
+
+func TestViewMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		tsig      map[string]string
+		listeners []listenerView
+		key       string
+		writer    dns.ResponseWriter
+		answer    string
+	}{
+		{
+			name:   "prefix",
+			answer: "web.example.com. 3600 IN A 10.0.0.17",
+		},
+		{
+			name:   "tsig key",
+			tsig:   map[string]string{"branch.key.": "branch"},
+			key:    "Branch.Key.",
+			answer: "web.example.com. 3600 IN A 192.0.2.17",
+		},
+		{
+			name:   "unverified tsig key",
+			tsig:   map[string]string{"branch.key.": "branch"},
+			key:    "branch.key.",
+			writer: &tsigFailedWriter{},
+			answer: "web.example.com. 3600 IN A 10.0.0.17",
+		},
+		{
+			name:      "tsig key before listener",
+			tsig:      map[string]string{"branch.key.": "branch"},
+			listeners: []listenerView{{port: 53, view: "default"}},
+			key:       "branch.key.",
+			answer:    "web.example.com. 3600 IN A 192.0.2.17",
+		},
+		{
+			name:      "listener address and port",
+			listeners: []listenerView{{addr: netip.MustParseAddr("127.0.0.1"), port: 53, view: "branch"}},
+			answer:    "web.example.com. 3600 IN A 192.0.2.17",
+		},
+		{
+			name:      "listener on other port",
+			listeners: []listenerView{{port: 5300, view: "branch"}},
+			answer:    "web.example.com. 3600 IN A 10.0.0.17",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t, withBranchView())
+			netboxdns.viewMapping = newViewMapping()
+			for key, view := range tt.tsig {
+				netboxdns.viewMapping.tsig[key] = view
+			}
+			netboxdns.viewMapping.listeners = tt.listeners
+			req := new(dns.Msg)
+			req.SetQuestion("web.example.com.", dns.TypeA)
+			if tt.key != "" {
+				req.SetTsig(tt.key, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			writer := tt.writer
+			if writer == nil {
+				writer = &test.ResponseWriter{}
+			}
+			rec := dnstest.NewRecorder(writer)
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].String() != test.A(tt.answer).String() {
+				t.Errorf("got answer %v, want %s", rec.Msg.Answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		in   string
+		addr string
+		port uint16
+		ok   bool
+	}{
+		{"192.0.2.53", "192.0.2.53", 0, true},
+		{"192.0.2.53:5353", "192.0.2.53", 5353, true},
+		{"[2001:db8::53]:53", "2001:db8::53", 53, true},
+		{"2001:db8::53", "2001:db8::53", 0, true},
+		{":5300", "", 5300, true},
+		{":0", "", 0, false},
+		{"localhost:53", "", 0, false},
+	}
+	for _, tt := range tests {
+		addr, port, ok := parseListener(tt.in)
+		if ok != tt.ok {
+			t.Errorf("parseListener(%q) ok = %t, want %t", tt.in, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		wantAddr := netip.Addr{}
+		if tt.addr != "" {
+			wantAddr = netip.MustParseAddr(tt.addr)
+		}
+		if addr != wantAddr || port != tt.port {
+			t.Errorf("parseListener(%q) = %v, %d, want %v, %d", tt.in, addr, port, wantAddr, tt.port)
+		}
+	}
+}
+
+func TestClientViews(t *testing.T) {
+	zones := make([]netbox.Zone, 4)
+	views := []netbox.View{
+		{ID: 1, Name: "default", Default: true, Prefixes: []netbox.Prefix{{ID: 1, Prefix: "10.0.0.0/8"}}},
+		{ID: 2, Name: "branch", Prefixes: []netbox.Prefix{{ID: 2, Prefix: "10.1.0.0/16"}}},
+		{ID: 3, Name: "lab", Prefixes: []netbox.Prefix{{ID: 3, Prefix: "10.1.0.0/16"}}},
+		{ID: 4, Name: "guest"},
+	}
+	for i := range zones {
+		zones[i] = netbox.Zone{ID: i + 1, Name: "example.com"}
+		zones[i].View.ID = views[i].ID
+	}
+	tests := []struct {
+		name     string
+		ip       string
+		viewName string
+		order    []string
+		fallback string
+		want     []int
+	}{
+		{name: "single prefix", ip: "10.2.0.1", want: []int{1}},
+		{name: "longest prefix first", ip: "10.1.0.1", want: []int{2, 3, 1}},
+		{name: "view order", ip: "10.1.0.1", order: []string{"lab"}, want: []int{3, 2, 1}},
+		{name: "no prefix", ip: "192.0.2.1", want: []int{1}},
+		{name: "fallback view", ip: "192.0.2.1", fallback: "guest", want: []int{4}},
+		{name: "fallback view unused", ip: "10.2.0.1", fallback: "guest", want: []int{1}},
+		{name: "view by name", ip: "10.2.0.1", viewName: "lab", want: []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := NewNetboxDNS()
+			netboxdns.snapshot.set(zones, views, nil)
+			netboxdns.viewOrder = tt.order
+			netboxdns.fallbackView = tt.fallback
+			got, err := netboxdns.clientViews(context.Background(), netip.MustParseAddr(tt.ip), tt.viewName)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got views %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupViewPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		remoteIP string
+		answer   string
+	}{
+		{
+			name:     "most specific prefix",
+			prefix:   "0.0.0.0/0",
+			remoteIP: "192.0.2.9",
+			answer:   "web.example.com. 3600 IN A 192.0.2.17",
+		},
+		{
+			name:     "fallback to default view",
+			prefix:   "10.0.0.0/8",
+			remoteIP: "198.51.100.1",
+			answer:   "web.example.com. 3600 IN A 10.0.0.17",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t, withBranchView())
+			netboxdns.snapshot.putView(netbox.View{
+				ID:       1,
+				Name:     "default",
+				Default:  true,
+				Prefixes: []netbox.Prefix{{ID: 1, Prefix: tt.prefix}},
+			})
+			req := new(dns.Msg)
+			req.SetQuestion("web.example.com.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tt.remoteIP})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].String() != test.A(tt.answer).String() {
+				t.Errorf("got answer %v, want %s", rec.Msg.Answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestLookupViewPrecedenceNegative(t *testing.T) {
+	netboxdns := newTestPlugin(t, withBranchView())
+	netboxdns.snapshot.putView(netbox.View{
+		ID:       1,
+		Name:     "default",
+		Default:  true,
+		Prefixes: []netbox.Prefix{{ID: 1, Prefix: "0.0.0.0/0"}},
+	})
+	// www.example.com is only in the zone of the less specific default view
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "192.0.2.9"})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeNameError || len(rec.Msg.Answer) != 0 {
+		t.Errorf(
+			"got %s with answer %v, want NXDOMAIN from the branch view",
+			dns.RcodeToString[rec.Msg.Rcode],
+			rec.Msg.Answer,
+		)
+	}
+}
@@ -0,0 +1,178 @@
+package netboxdns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+const (
+	webhookSignatureHeader string = "X-Hook-Signature"
+	webhookMaxBodySize     int64  = 1 << 20
+)
+
+// webhookReceiver accepts Netbox event rule webhooks and applies the changed
+// objects to the snapshot
+type webhookReceiver struct {
+	addr   string
+	secret string
+	server *http.Server
+}
+
+// webhookPayload is the default body of a Netbox webhook
+type webhookPayload struct {
+	Event      string          `json:"event"`
+	Model      string          `json:"model"`
+	ObjectType string          `json:"object_type"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// objectType returns the changed object type as "app_label.model"
+func (payload *webhookPayload) objectType() string {
+	if strings.Contains(payload.ObjectType, ".") {
+		return payload.ObjectType
+	}
+	return "netbox_dns." + payload.Model
+}
+
+// deleted reports whether the event is a deletion. Netbox before v4.2 sends
+// "deleted", later versions send "object_deleted".
+func (payload *webhookPayload) deleted() bool {
+	return strings.HasSuffix(payload.Event, "deleted")
+}
+
+func (netboxdns *NetboxDNS) startWebhook() error {
+	listener, err := net.Listen("tcp", netboxdns.webhook.addr)
+	if err != nil {
+		return fmt.Errorf("could not start webhook listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", netboxdns.serveWebhook)
+	netboxdns.webhook.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	go func() {
+		err := netboxdns.webhook.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("webhook listener stopped: %v", err)
+		}
+	}()
+	logger.Infof("listening for Netbox webhooks on %s", listener.Addr())
+	return nil
+}
+
+func (netboxdns *NetboxDNS) stopWebhook() error {
+	if netboxdns.webhook.server == nil {
+		return nil
+	}
+	return netboxdns.webhook.server.Close()
+}
+
+func (netboxdns *NetboxDNS) serveWebhook(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, webhookMaxBodySize))
+	if err != nil {
+		http.Error(writer, "could not read body", http.StatusBadRequest)
+		return
+	}
+	if !validWebhookSignature(
+		netboxdns.webhook.secret,
+		body,
+		request.Header.Get(webhookSignatureHeader),
+	) {
+		logger.Warningf("rejected webhook from %s: invalid signature", request.RemoteAddr)
+		http.Error(writer, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(writer, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if !netboxdns.snapshot.ready() {
+		// nothing to update; the initial load will include this change
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	err = netboxdns.applyWebhook(request.Context(), &payload)
+	netboxdns.trackChanges(request.Context())
+	if err != nil {
+		logger.Errorf("could not apply webhook for %s: %v", payload.objectType(), err)
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// applyWebhook updates the snapshot from the object contained in a webhook.
+// The payload holds the same representation the API returns, so it is stored
+// as is.
+func (netboxdns *NetboxDNS) applyWebhook(ctx context.Context, payload *webhookPayload) error {
+	objectType := payload.objectType()
+	switch objectType {
+	case netbox.ObjectTypeRecord:
+		var record netbox.Record
+		if err := json.Unmarshal(payload.Data, &record); err != nil {
+			return err
+		}
+		if payload.deleted() {
+			netboxdns.snapshot.deleteRecord(record.ID)
+		} else {
+			netboxdns.snapshot.putRecord(record)
+		}
+	case netbox.ObjectTypeZone:
+		var zone netbox.Zone
+		if err := json.Unmarshal(payload.Data, &zone); err != nil {
+			return err
+		}
+		if payload.deleted() {
+			netboxdns.snapshot.deleteZone(zone.ID)
+		} else {
+			return netboxdns.putZone(ctx, zone)
+		}
+	case netbox.ObjectTypeView:
+		var view netbox.View
+		if err := json.Unmarshal(payload.Data, &view); err != nil {
+			return err
+		}
+		if payload.deleted() {
+			netboxdns.snapshot.deleteView(view.ID)
+		} else {
+			netboxdns.snapshot.putView(view)
+		}
+	default:
+		logger.Debugf("ignoring webhook for %s", objectType)
+		return nil
+	}
+	logger.Debugf("applied webhook %s for %s", payload.Event, objectType)
+	return nil
+}
@@ -0,0 +1,86 @@
+package netboxdns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+)
+
+const testWebhookSecret string = "mysecret"
+
+func testWebhookRequest(body string, secret string) *http.Request {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(body))
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	request.Header.Set(webhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return request
+}
+
+func TestWebhook(t *testing.T) {
+	netboxdns := &NetboxDNS{
+		snapshot: testSnapshot(),
+		webhook:  &webhookReceiver{secret: testWebhookSecret},
+	}
+	tests := []struct {
+		name       string
+		request    *http.Request
+		wantStatus int
+		fqdn       string
+		wantCount  int
+	}{
+		{
+			"invalid signature",
+			testWebhookRequest(`{"event":"created","model":"record","data":{"id":10,"name":"new","type":"A","value":"10.0.0.20","fqdn":"new.example.com.","zone":{"id":1,"name":"example.com"}}}`, "wrong"),
+			http.StatusUnauthorized,
+			"new.example.com",
+			0,
+		},
+		{
+			"record created",
+			testWebhookRequest(`{"event":"created","model":"record","data":{"id":10,"name":"new","type":"A","value":"10.0.0.20","fqdn":"new.example.com.","zone":{"id":1,"name":"example.com"}}}`, testWebhookSecret),
+			http.StatusNoContent,
+			"new.example.com",
+			1,
+		},
+		{
+			"record deleted",
+			testWebhookRequest(`{"event":"object_deleted","object_type":"netbox_dns.record","model":"record","data":{"id":2,"name":"web","type":"A","value":"10.0.0.17","fqdn":"web.example.com.","zone":{"id":1,"name":"example.com"}}}`, testWebhookSecret),
+			http.StatusNoContent,
+			"web.example.com",
+			1,
+		},
+		{
+			"unrelated object",
+			testWebhookRequest(`{"event":"created","object_type":"dcim.device","model":"device","data":{"id":1}}`, testWebhookSecret),
+			http.StatusNoContent,
+			"web.example.com",
+			1,
+		},
+		{
+			"invalid payload",
+			testWebhookRequest(`{"event":`, testWebhookSecret),
+			http.StatusBadRequest,
+			"web.example.com",
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			netboxdns.serveWebhook(recorder, tt.request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			records := netboxdns.snapshot.getRecords(&netbox.RecordQuery{FQDN: tt.fqdn})
+			if len(records) != tt.wantCount {
+				t.Errorf("got %d records for %s, want %d", len(records), tt.fqdn, tt.wantCount)
+			}
+		})
+	}
+}
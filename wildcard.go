@@ -0,0 +1,164 @@
+package netboxdns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// zoneNames returns the names that exist in zone: the owner names of its
+// records and the empty non-terminals between them and the apex. The names are
+// cached in the snapshot until the zone changes; without a snapshot, the
+// entire zone is fetched once per query. The returned map must not be
+// modified.
+func (netboxdns *NetboxDNS) zoneNames(
+	ctx context.Context,
+	zone *netbox.Zone,
+) (map[string]bool, error) {
+	if !netboxdns.snapshot.ready() {
+		return netboxdns.queryZoneNames(ctx, zone)
+	}
+	return zoneCached(netboxdns, zone, "names", func() (map[string]bool, error) {
+		return netboxdns.buildZoneNames(ctx, zone)
+	})
+}
+
+// queryZoneNames returns the names of zone fetched from the Netbox API, which
+// are cached for the query if ctx is the context of one
+func (netboxdns *NetboxDNS) queryZoneNames(
+	ctx context.Context,
+	zone *netbox.Zone,
+) (map[string]bool, error) {
+	cache, ok := ctx.Value(queryCacheKey{}).(*queryCache)
+	if !ok {
+		return netboxdns.buildZoneNames(ctx, zone)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if names, ok := cache.names[zone.ID]; ok {
+		return names, nil
+	}
+	names, err := netboxdns.buildZoneNames(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if cache.names == nil {
+		cache.names = make(map[int]map[string]bool)
+	}
+	cache.names[zone.ID] = names
+	return names, nil
+}
+
+func (netboxdns *NetboxDNS) buildZoneNames(
+	ctx context.Context,
+	zone *netbox.Zone,
+) (map[string]bool, error) {
+	records, err := netboxdns.getRecords(ctx, &netbox.RecordQuery{Zone: zone})
+	if err != nil {
+		return nil, err
+	}
+	apex := fqdnKey(zone.Name)
+	names := map[string]bool{apex: true}
+	for _, record := range records {
+		name := fqdnKey(record.FQDN)
+		for !names[name] && dns.IsSubDomain(apex, name) {
+			names[name] = true
+			name = parentName(name)
+		}
+	}
+	return names, nil
+}
+
+// closestEncloser returns the longest existing ancestor of qname, as defined
+// in RFC 4592 section 3.3.1
+func closestEncloser(qname string, names map[string]bool) string {
+	encloser := fqdnKey(qname)
+	for encloser != "." && !names[encloser] {
+		encloser = parentName(encloser)
+	}
+	return encloser
+}
+
+// sourceOfSynthesis returns the wildcard owner that qname would be expanded
+// from, or an empty string if qname exists or no such wildcard exists
+func (netboxdns *NetboxDNS) sourceOfSynthesis(
+	ctx context.Context,
+	qname string,
+	zone *netbox.Zone,
+) (string, error) {
+	names, err := netboxdns.zoneNames(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	if names[fqdnKey(qname)] {
+		return "", nil
+	}
+	wildcard := "*." + closestEncloser(qname, names)
+	if !names[wildcard] {
+		return "", nil
+	}
+	return wildcard, nil
+}
+
+// lookupWildcard synthesizes the answer for qname from the wildcard at its
+// closest encloser. A wildcard CNAME is followed like an exact one.
+func (netboxdns *NetboxDNS) lookupWildcard(
+	ctx context.Context,
+	qname string,
+	qtype uint16,
+	zone *netbox.Zone,
+) (*lookupResponse, error) {
+	span, ctx := netbox.StartSpan(ctx, "lookupWildcard")
+	defer span.Finish()
+	wildcard, err := netboxdns.sourceOfSynthesis(ctx, qname, zone)
+	if err != nil || wildcard == "" {
+		return nil, err
+	}
+	queryTypes := []string{dns.TypeToString[qtype]}
+	if qtype == dns.TypeA || qtype == dns.TypeAAAA {
+		queryTypes = append(queryTypes, "CNAME")
+	}
+	records, err := netboxdns.getRecords(
+		ctx,
+		&netbox.RecordQuery{
+			FQDN: wildcard,
+			Type: queryTypes,
+			Zone: zone,
+		},
+	)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	for i := range records {
+		records[i].FQDN = dns.Fqdn(qname)
+	}
+	answer, err := recordsToRR(records)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range answer {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+		target, err := netboxdns.lookupDirect(
+			ctx,
+			strings.TrimSuffix(cname.Target, "."),
+			qtype,
+			zone,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if target != nil {
+			answer = append(answer, target.Answer...)
+		}
+	}
+	return &lookupResponse{
+		Answer:   answer,
+		Extra:    []dns.RR{},
+		Wildcard: wildcard,
+	}, nil
+}
@@ -0,0 +1,191 @@
+package netboxdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestLookupWildcard(t *testing.T) {
+	soa := []dns.RR{
+		test.SOA("example.com. 3600 IN SOA dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600"),
+	}
+	tcs := []test.Case{
+		{
+			Qname: "foo.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("foo.example.com. 3600 IN A 10.0.0.99")},
+		},
+		{
+			Qname: "foo.bar.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("foo.bar.example.com. 3600 IN A 10.0.0.99")},
+		},
+		{Qname: "foo.example.com.", Qtype: dns.TypeMX, Ns: soa},
+		{
+			Qname: "x.b.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.CNAME("x.b.example.com. 3600 IN CNAME web.example.com."),
+				test.A("web.example.com. 3600 IN A 10.0.0.17"),
+			},
+		},
+		// empty non-terminal blocks the wildcard above it
+		{Qname: "b.example.com.", Qtype: dns.TypeA, Ns: soa},
+		{Qname: "x.a.b.example.com.", Qtype: dns.TypeA, Ns: soa},
+		{Qname: "web.example.com.", Qtype: dns.TypeMX, Ns: soa},
+		// the wildcard of the parent zone does not apply in sub.example.com
+		{Qname: "nx.sub.example.com.", Qtype: dns.TypeA, Rcode: dns.RcodeNameError},
+	}
+	netboxdns := newTestPlugin(t, withWildcards())
+	for _, tc := range tcs {
+		t.Run(tc.Qname+" "+dns.TypeToString[tc.Qtype], func(t *testing.T) {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			_, err := netboxdns.ServeDNS(context.Background(), rec, tc.Msg())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := test.Header(tc, rec.Msg); err != nil {
+				t.Error(err)
+			}
+			if err := test.Section(tc, test.Answer, rec.Msg.Answer); err != nil {
+				t.Error(err)
+			}
+			if err := test.Section(tc, test.Ns, rec.Msg.Ns); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLookupWildcardSigned(t *testing.T) {
+	netboxdns := newTestPlugin(t, withWildcards(), withDNSSEC())
+	msg := new(dns.Msg)
+	msg.SetQuestion("foo.example.com.", dns.TypeA)
+	msg.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var answer []dns.RR
+	var sig *dns.RRSIG
+	for _, rr := range rec.Msg.Answer {
+		if s, ok := rr.(*dns.RRSIG); ok {
+			sig = s
+		} else {
+			answer = append(answer, rr)
+		}
+	}
+	if sig == nil {
+		t.Fatalf("wildcard answer not signed: %v", rec.Msg)
+	}
+	if sig.Hdr.Name != "foo.example.com." || sig.Labels != 2 {
+		t.Errorf("signature not for wildcard expansion: %v", sig)
+	}
+	zsk, _ := readZoneKey(testZSK)
+	if err := sig.Verify(zsk.dnskey, answer); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	var nsec int
+	for _, rr := range rec.Msg.Ns {
+		if rr.Header().Rrtype == dns.TypeNSEC {
+			nsec++
+		}
+	}
+	if nsec != 1 {
+		t.Errorf("got %d NSEC records, want 1 proving that qname does not exist", nsec)
+	}
+}
+
+func TestZoneNamesCache(t *testing.T) {
+	netboxdns := newTestPlugin(t, withWildcards())
+	zone, _ := netboxdns.snapshot.getZone(1)
+	names, err := netboxdns.zoneNames(context.Background(), &zone)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !names["web.example.com."] || !names["b.example.com."] || names["new.example.com."] {
+		t.Errorf("got names %v, want the owners and empty non-terminals of example.com", names)
+	}
+	cached, _ := netboxdns.zoneNames(context.Background(), &zone)
+	if reflect.ValueOf(cached).Pointer() != reflect.ValueOf(names).Pointer() {
+		t.Error("names were built again for an unchanged zone")
+	}
+
+	netboxdns.snapshot.putRecord(netbox.Record{ID: 30, Name: "new", Type: "A", Value: "10.0.0.40", FQDN: "new.example.com.", Zone: zone})
+	names, _ = netboxdns.zoneNames(context.Background(), &zone)
+	if !names["new.example.com."] {
+		t.Errorf("got names %v after a change of the zone, want new.example.com", names)
+	}
+}
+
+func TestZoneNamesPerQuery(t *testing.T) {
+	view := netbox.View{ID: 1, Name: "default", Default: true}
+	zone := netbox.Zone{ID: 1, Name: "example.com", DefaultTTL: 3600}
+	zone.View.ID = view.ID
+	records := []netbox.Record{
+		{ID: 1, Name: "@", Type: "SOA", Value: "dns01.example.com. admin.example.com. 1 43200 7200 2419200 3600", FQDN: "example.com.", Zone: zone},
+		{ID: 2, Name: "web", Type: "A", Value: "10.0.0.17", FQDN: "web.example.com.", Zone: zone},
+	}
+	zoneFetches := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/plugins/netbox-dns/zones/", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{Count: 1, Results: []netbox.Zone{zone}})
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/views/", func(writer http.ResponseWriter, request *http.Request) {
+		if path.Base(request.URL.Path) == "views" {
+			json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.View]{Count: 1, Results: []netbox.View{view}})
+			return
+		}
+		json.NewEncoder(writer).Encode(view)
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/records/", func(writer http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+		var out []netbox.Record
+		for _, record := range records {
+			if fqdn := query.Get("fqdn"); fqdn != "" && dns.Fqdn(fqdn) != record.FQDN {
+				continue
+			}
+			if name := query.Get("name"); name != "" && name != record.Name {
+				continue
+			}
+			if types := query["type"]; len(types) > 0 && !slices.Contains(types, record.Type) {
+				continue
+			}
+			out = append(out, record)
+		}
+		if query.Get("fqdn") == "" && query.Get("name") == "" {
+			zoneFetches++
+		}
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Record]{Count: len(out), Results: out})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("nx.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeNameError {
+		t.Errorf("got rcode %s, want NXDOMAIN", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if zoneFetches != 1 {
+		t.Errorf("the zone was fetched %d times for a query, want once", zoneFetches)
+	}
+}
@@ -0,0 +1,146 @@
+package netboxdns
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+// zoneChange describes how the contents of a zone changed between two
+// snapshot updates
+type zoneChange struct {
+	zone    netbox.Zone
+	oldSOA  *dns.SOA
+	newSOA  *dns.SOA
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+// serialChanged reports whether the SOA serial of the zone changed
+func (change *zoneChange) serialChanged() bool {
+	return change.oldSOA.Serial != change.newSOA.Serial
+}
+
+// zoneState is the contents of a zone as last seen by the change tracker
+type zoneState struct {
+	soa *dns.SOA
+	rrs map[string]dns.RR
+}
+
+// changeTracker compares zones after every snapshot update and reports
+// differences to its listeners
+type changeTracker struct {
+	mu        sync.Mutex
+	states    map[int]zoneState
+	listeners []func(zoneChange)
+	removed   []func(zoneID int)
+}
+
+func newChangeTracker() *changeTracker {
+	return &changeTracker{states: make(map[int]zoneState)}
+}
+
+// zoneChanges returns the change tracker of the plugin, creating it on
+// first use
+func (netboxdns *NetboxDNS) zoneChanges() *changeTracker {
+	if netboxdns.changes == nil {
+		netboxdns.changes = newChangeTracker()
+	}
+	return netboxdns.changes
+}
+
+// onChange registers a function called for each changed zone
+func (tracker *changeTracker) onChange(listener func(zoneChange)) {
+	tracker.listeners = append(tracker.listeners, listener)
+}
+
+// onRemove registers a function called for each deleted zone
+func (tracker *changeTracker) onRemove(listener func(zoneID int)) {
+	tracker.removed = append(tracker.removed, listener)
+}
+
+// trackChanges compares the zones changed in the snapshot since the last call
+// with their previous state. Zones seen for the first time are recorded
+// without reporting a change.
+func (netboxdns *NetboxDNS) trackChanges(ctx context.Context) {
+	tracker := netboxdns.changes
+	if tracker == nil {
+		return
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	for _, id := range netboxdns.dirtyZones() {
+		zone, ok := netboxdns.snapshot.getZone(id)
+		if !ok {
+			delete(tracker.states, id)
+			for _, listener := range tracker.removed {
+				listener(id)
+			}
+			continue
+		}
+		soa, rrs, err := netboxdns.zoneRRs(ctx, &zone)
+		if err != nil {
+			logger.Debugf("could not track changes of zone %q: %v", zone.Name, err)
+			continue
+		}
+		current := zoneState{soa: soa, rrs: make(map[string]dns.RR, len(rrs))}
+		for _, rr := range rrs {
+			current.rrs[rr.String()] = rr
+		}
+		previous, existed := tracker.states[id]
+		tracker.states[id] = current
+		if !existed {
+			continue
+		}
+		change := diffZoneState(zone, previous, current)
+		if change == nil {
+			continue
+		}
+		for _, listener := range tracker.listeners {
+			listener(*change)
+		}
+	}
+}
+
+// dirtyZones returns the IDs of the zones changed in the snapshot or in the
+// records of a source since the last call
+func (netboxdns *NetboxDNS) dirtyZones() []int {
+	ids := netboxdns.snapshot.takeDirtyZones()
+	for _, snap := range netboxdns.sourceSnapshots() {
+		for _, id := range snap.takeDirtyZones() {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// diffZoneState returns the change between two states of a zone, or nil if
+// they hold the same records and serial
+func diffZoneState(zone netbox.Zone, previous zoneState, current zoneState) *zoneChange {
+	change := &zoneChange{
+		zone:   zone,
+		oldSOA: previous.soa,
+		newSOA: current.soa,
+	}
+	for key, rr := range previous.rrs {
+		if _, ok := current.rrs[key]; !ok {
+			change.deleted = append(change.deleted, rr)
+		}
+	}
+	for key, rr := range current.rrs {
+		if _, ok := previous.rrs[key]; !ok {
+			change.added = append(change.added, rr)
+		}
+	}
+	if !change.serialChanged() &&
+		len(change.deleted) == 0 &&
+		len(change.added) == 0 {
+		return nil
+	}
+	return change
+}
@@ -0,0 +1,240 @@
+package netboxdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/doubleu-labs/coredns-netbox-plugin-dns/internal/netbox"
+	"github.com/miekg/dns"
+)
+
+func TestZoneFilterSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter netbox.ZoneQuery
+		qname  string
+		rcode  int
+	}{
+		{
+			name:  "no filter",
+			qname: "host.sub.example.com.",
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:   "zone of tenant",
+			filter: netbox.ZoneQuery{Tenant: []string{"unit-a"}},
+			qname:  "web.example.com.",
+			rcode:  dns.RcodeSuccess,
+		},
+		{
+			name:   "zone of other tenant",
+			filter: netbox.ZoneQuery{Tenant: []string{"unit-a"}},
+			qname:  "host.sub.example.com.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "zone with all tags",
+			filter: netbox.ZoneQuery{Tag: []string{"internal", "dmz"}},
+			qname:  "host.sub.example.com.",
+			rcode:  dns.RcodeSuccess,
+		},
+		{
+			name:   "zone without all tags",
+			filter: netbox.ZoneQuery{Tag: []string{"internal", "dmz"}},
+			qname:  "web.example.com.",
+			rcode:  dns.RcodeNameError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netboxdns := newTestPlugin(t)
+			netboxdns.zoneFilter = tt.filter
+			zone, _ := netboxdns.snapshot.getZone(1)
+			zone.Tenant = &netbox.NestedObject{ID: 1, Name: "Unit A", Slug: "unit-a"}
+			zone.Tags = []netbox.NestedObject{{ID: 1, Name: "Internal", Slug: "internal"}}
+			netboxdns.snapshot.putZone(zone)
+			zone, _ = netboxdns.snapshot.getZone(2)
+			zone.Tenant = &netbox.NestedObject{ID: 2, Name: "Unit B", Slug: "unit-b"}
+			zone.Tags = []netbox.NestedObject{
+				{ID: 1, Name: "Internal", Slug: "internal"},
+				{ID: 2, Name: "DMZ", Slug: "dmz"},
+			}
+			netboxdns.snapshot.putZone(zone)
+
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+		})
+	}
+}
+
+func TestZoneFilterAPI(t *testing.T) {
+	unitA := &netbox.NestedObject{ID: 1, Name: "Unit A", Slug: "unit-a"}
+	zones := []netbox.Zone{
+		{ID: 1, Name: "example.com", DefaultTTL: 3600, Tenant: unitA},
+		// a zone Netbox returns although it does not match the filter
+		{ID: 2, Name: "example.org", DefaultTTL: 3600},
+	}
+	records := []netbox.Record{
+		{ID: 1, Name: "web", Type: "A", Value: "10.0.0.17", FQDN: "web.example.com.", Zone: netbox.Zone{ID: 1, Name: "example.com"}},
+		{ID: 2, Name: "web", Type: "A", Value: "10.0.0.18", FQDN: "web.example.org.", Zone: netbox.Zone{ID: 2, Name: "example.org"}},
+	}
+	var queries []url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/plugins/netbox-dns/zones/", func(writer http.ResponseWriter, request *http.Request) {
+		queries = append(queries, request.URL.Query())
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{Count: len(zones), Results: zones})
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/records/", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Record]{Count: len(records), Results: records})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+	netboxdns.zoneFilter = netbox.ZoneQuery{
+		Tenant: []string{"unit-a"},
+		Params: url.Values{"cf_environment": []string{"production"}},
+	}
+
+	served, err := netboxdns.getZones(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(served) != 1 || served[0].ID != 1 {
+		t.Errorf("got zones %v, want example.com", served)
+	}
+	got, err := netboxdns.getRecords(context.Background(), &netbox.RecordQuery{Type: []string{"A"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(got) != 1 || got[0].ID != 1 || got[0].Zone.Tenant == nil || *got[0].TTL != 3600 {
+		t.Errorf("got records %v, want web.example.com with the zone of tenant unit-a", got)
+	}
+	for _, query := range queries {
+		if query.Get("tenant") != "unit-a" || query.Get("cf_environment") != "production" {
+			t.Errorf("got zone query %v, want tenant and custom filter", query)
+		}
+	}
+}
+
+func TestZoneFilterSnapshotRecords(t *testing.T) {
+	zone := netbox.Zone{ID: 1, Name: "example.com", DefaultTTL: 3600}
+	// the records endpoint returns records of zones excluded by zone_filter
+	records := []netbox.Record{
+		{ID: 1, Name: "web", Type: "A", Value: "10.0.0.17", FQDN: "web.example.com.", Zone: netbox.Zone{ID: 1, Name: "example.com"}},
+		{ID: 2, Name: "web", Type: "A", Value: "10.0.0.18", FQDN: "web.example.org.", Zone: netbox.Zone{ID: 2, Name: "example.org"}},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/plugins/netbox-dns/zones/", func(writer http.ResponseWriter, request *http.Request) {
+		if id := request.URL.Query().Get("id"); id != "" && id != "1" {
+			json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{})
+			return
+		}
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{Count: 1, Results: []netbox.Zone{zone}})
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/views/", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.View]{})
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/records/", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Record]{Count: len(records), Results: records})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+	netboxdns.zoneFilter = netbox.ZoneQuery{
+		Params: url.Values{"cf_environment": []string{"production"}},
+	}
+	if err := netboxdns.loadSnapshot(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got := netboxdns.snapshot.getRecords(&netbox.RecordQuery{Value: "10.0.0.18"})
+	if len(got) != 0 {
+		t.Errorf("got records %v of a filtered zone after load", got)
+	}
+
+	// a webhook for a record of the filtered zone does not add it
+	netboxdns.snapshot.putRecord(records[1])
+	got = netboxdns.snapshot.getRecords(&netbox.RecordQuery{Type: []string{"A"}})
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("got records %v, want web.example.com", got)
+	}
+
+	// nor does a change of the filtered zone
+	if err := netboxdns.putZone(context.Background(), records[1].Zone); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := netboxdns.snapshot.getZone(2); ok {
+		t.Error("filtered zone was added to the snapshot")
+	}
+}
+
+func TestZoneFilterAPIZonesPerQuery(t *testing.T) {
+	view := netbox.View{ID: 1, Name: "default", Default: true}
+	zone := netbox.Zone{ID: 1, Name: "example.com", DefaultTTL: 3600}
+	zone.View.ID = view.ID
+	records := []netbox.Record{
+		{ID: 1, Name: "web", Type: "A", Value: "10.0.0.17", FQDN: "web.example.com.", Zone: netbox.Zone{ID: 1, Name: "example.com"}},
+	}
+	zoneRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/plugins/netbox-dns/zones/", func(writer http.ResponseWriter, request *http.Request) {
+		zoneRequests++
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Zone]{Count: 1, Results: []netbox.Zone{zone}})
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/views/", func(writer http.ResponseWriter, request *http.Request) {
+		if path.Base(request.URL.Path) == "views" {
+			json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.View]{Count: 1, Results: []netbox.View{view}})
+			return
+		}
+		json.NewEncoder(writer).Encode(view)
+	})
+	mux.HandleFunc("/api/plugins/netbox-dns/records/", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(netbox.APIManyResponse[netbox.Record]{Count: len(records), Results: records})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	netboxURL, _ := url.Parse(server.URL + "/api/plugins/netbox-dns")
+
+	netboxdns := NewNetboxDNS()
+	netboxdns.requestClient = &netbox.APIRequestClient{
+		Client:    server.Client(),
+		NetboxURL: netboxURL,
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := netboxdns.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rec.Msg.Answer) != 1 {
+		t.Errorf("got answer %v, want web.example.com", rec.Msg.Answer)
+	}
+	if zoneRequests != 1 {
+		t.Errorf("zones were requested %d times for a query, want once", zoneRequests)
+	}
+}